@@ -6,12 +6,9 @@ import (
 	"time"
 
 	"github.com/emanoelxavier/openid2go/openid"
-	"github.com/gorilla/context"
 	"github.com/justinas/alice"
 )
 
-const UserKey = 0
-
 func authenticatedHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, "The user was authenticated successfully!")
 }
@@ -21,7 +18,7 @@ func unauthenticatedHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func meHandler(w http.ResponseWriter, r *http.Request) {
-	u := context.Get(r, UserKey).(*openid.User)
+	u, _ := openid.UserFromContext(r.Context())
 	fmt.Fprintf(w, "Hello %v! this is all I know about you: %+v.", u.ID, u)
 }
 
@@ -39,31 +36,13 @@ func myMiddleware(h http.Handler) http.Handler {
 var provider *openid.Provider
 var configuration *openid.Configuration
 
-type userHandlerAdapter struct {
-	h http.Handler
-}
-
-func (a *userHandlerAdapter) ServeHTTPWithUser(u *openid.User, rw http.ResponseWriter, req *http.Request) {
-	context.Set(req, UserKey, u)
-	a.h.ServeHTTP(rw, req)
-}
-
-func (a *userHandlerAdapter) myAuthenticateUser(h http.Handler) http.Handler {
-	a.h = h
-	return openid.AuthenticateUser(configuration, a)
-}
-
-func myAuthenticate(h http.Handler) http.Handler {
-	return openid.Authenticate(configuration, h)
-}
-
 func main() {
 	configuration, _ = openid.NewConfiguration(openid.ProvidersGetter(getProviders_googlePlayground))
 
-	adapter := new(userHandlerAdapter)
+	authenticate := openid.Middleware(configuration)
 
-	http.Handle("/me", alice.New(timeoutMiddleware, myMiddleware, adapter.myAuthenticateUser).ThenFunc(meHandler))
-	http.Handle("/authn", alice.New(timeoutMiddleware, myMiddleware, myAuthenticate).ThenFunc(authenticatedHandler))
+	http.Handle("/me", alice.New(timeoutMiddleware, myMiddleware, authenticate).ThenFunc(meHandler))
+	http.Handle("/authn", alice.New(timeoutMiddleware, myMiddleware, authenticate).ThenFunc(authenticatedHandler))
 	http.HandleFunc("/", unauthenticatedHandler)
 
 	http.ListenAndServe(":5103", nil)
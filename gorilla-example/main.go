@@ -5,11 +5,8 @@ import (
 	"net/http"
 
 	"github.com/emanoelxavier/openid2go/openid"
-	"github.com/gorilla/context"
 )
 
-const UserKey = 0
-
 func authenticatedHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, "The user was authenticated successfully!")
 }
@@ -19,25 +16,14 @@ func unauthenticatedHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func meHandler(w http.ResponseWriter, r *http.Request) {
-	u := context.Get(r, UserKey).(*openid.User)
+	u, _ := openid.UserFromContext(r.Context())
 	fmt.Fprintf(w, "Hello %v! This is all I know about you: %+v", u.ID, u)
 }
 
-type userHandlerAdapter struct {
-	h http.HandlerFunc
-}
-
-func (uh userHandlerAdapter) ServeHTTPWithUser(u *openid.User, rw http.ResponseWriter, req *http.Request) {
-	context.Set(req, UserKey, u)
-	uh.h.ServeHTTP(rw, req)
-}
-
 func main() {
 	configuration, _ := openid.NewConfiguration(openid.ProvidersGetter(getProviders_googlePlayground))
 
-	handlerAdapter := userHandlerAdapter{h: meHandler}
-
-	http.Handle("/me", openid.AuthenticateUser(configuration, handlerAdapter))
+	http.Handle("/me", openid.Authenticate(configuration, http.HandlerFunc(meHandler)))
 	http.Handle("/authn", openid.Authenticate(configuration, http.HandlerFunc(authenticatedHandler)))
 	http.HandleFunc("/", unauthenticatedHandler)
 
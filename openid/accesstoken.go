@@ -0,0 +1,110 @@
+package openid
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const clientIDClaimName = "client_id"
+const jwtIDClaimName = "jti"
+const typeJwtHeaderName = "typ"
+
+// accessTokenType is the 'typ' header of the JWT access tokens, see RFC 9068 section 2.1.
+const accessTokenType = "at+jwt"
+
+// AccessTokenValidation option makes the Configuration validate OAuth 2.0 JWT access tokens, as
+// described in RFC 9068, instead of ID Tokens:
+//
+//   - the 'typ' header must be 'at+jwt' or 'application/at+jwt';
+//   - the 'aud' claim must match one of the provider Audiences instead of its ClientIDs;
+//   - the 'exp', 'iat', 'jti' and 'client_id' claims are required.
+//
+// The scopes and the client id of the access token are available through the User Scopes and
+// ClientID methods.
+// When this option is not used the tokens with the 'typ' header 'at+jwt' are rejected, preventing
+// access tokens from being accepted as ID Tokens.
+func AccessTokenValidation() func(*Configuration) error {
+	return func(c *Configuration) error {
+		c.tokenValidator.(*idTokenValidator).accessTokens = true
+		return nil
+	}
+}
+
+// ClientID returns the client the access token was issued to, found in its 'client_id' claim.
+func (u *User) ClientID() string {
+	s, _ := u.Claims[clientIDClaimName].(string)
+	return s
+}
+
+// validateTokenType validates that the type of the token matches the type expected by the
+// validator, refusing access tokens as ID Tokens and vice versa.
+func (tv *idTokenValidator) validateTokenType(jt *jwtToken) error {
+	typ, _ := jt.Header[typeJwtHeaderName].(string)
+	isAccessToken := strings.EqualFold(typ, accessTokenType) || strings.EqualFold(typ, "application/"+accessTokenType)
+
+	if isAccessToken == tv.accessTokens {
+		if tv.accessTokens {
+			return validateAccessTokenClaims(jt)
+		}
+
+		return nil
+	}
+
+	expected := "an ID Token"
+	if tv.accessTokens {
+		expected = "an access token with the type " + accessTokenType
+	}
+
+	return &ValidationError{
+		Code:       ValidationErrorInvalidTokenType,
+		Message:    fmt.Sprintf("The token type %q is not valid, expected %v.", typ, expected),
+		HTTPStatus: http.StatusUnauthorized,
+	}
+}
+
+func validateAccessTokenClaims(jt *jwtToken) error {
+	claims := jt.Claims
+
+	if _, ok, err := getTimeClaim(claims, expirationClaimName); err != nil {
+		return err
+	} else if !ok {
+		return &ValidationError{
+			Code:       ValidationErrorExpirationNotFound,
+			Message:    "The token 'exp' claim was not found.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	if _, ok, err := getTimeClaim(claims, issuedAtClaimName); err != nil {
+		return err
+	} else if !ok {
+		return &ValidationError{
+			Code:       ValidationErrorIssuedAtNotFound,
+			Message:    "The token 'iat' claim was not found.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	if jti, _ := claims[jwtIDClaimName].(string); jti == "" {
+		return &ValidationError{
+			Code:       ValidationErrorJwtIDNotFound,
+			Message:    "The token 'jti' claim was not found or was empty.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	if cID, _ := claims[clientIDClaimName].(string); cID == "" {
+		return &ValidationError{
+			Code:       ValidationErrorClientIDNotFound,
+			Message:    "The token 'client_id' claim was not found or was empty.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	return nil
+}
+
+func validateResourceAudiences(jt *jwtToken, p *Provider) (string, error) {
+	return matchAudiences(jt, p, p.Audiences, "audience")
+}
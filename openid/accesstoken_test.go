@@ -0,0 +1,162 @@
+package openid
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_validateTokenType_WhenAccessTokenIsUsedAsIDToken(t *testing.T) {
+	_, _, _, _, tv := createIDTokenValidator(t)
+
+	for _, typ := range []string{"at+jwt", "application/at+JWT"} {
+		jt := createAccessToken()
+		jt.Header["typ"] = typ
+
+		err := tv.validateTokenType(jt)
+
+		expectValidationError(t, err, ValidationErrorInvalidTokenType, http.StatusUnauthorized, nil)
+	}
+}
+
+func Test_validateTokenType_WhenIDTokenIsUsedAsAccessToken(t *testing.T) {
+	tv := createAccessTokenValidator(t)
+
+	for _, typ := range []interface{}{"JWT", nil} {
+		jt := createAccessToken()
+		jt.Header["typ"] = typ
+
+		err := tv.validateTokenType(jt)
+
+		expectValidationError(t, err, ValidationErrorInvalidTokenType, http.StatusUnauthorized, nil)
+	}
+}
+
+func Test_validateTokenType_WhenAccessTokenIsValid(t *testing.T) {
+	tv := createAccessTokenValidator(t)
+
+	for _, typ := range []string{"at+jwt", "application/at+jwt"} {
+		jt := createAccessToken()
+		jt.Header["typ"] = typ
+
+		if err := tv.validateTokenType(jt); err != nil {
+			t.Error("An error was returned but not expected for", typ, err)
+		}
+	}
+}
+
+func Test_validateTokenType_WhenAccessTokenClaimsAreMissing(t *testing.T) {
+	tv := createAccessTokenValidator(t)
+
+	for claim, code := range map[string]ValidationErrorCode{
+		"exp":       ValidationErrorExpirationNotFound,
+		"iat":       ValidationErrorIssuedAtNotFound,
+		"jti":       ValidationErrorJwtIDNotFound,
+		"client_id": ValidationErrorClientIDNotFound,
+	} {
+		jt := createAccessToken()
+		delete(jt.Claims, claim)
+
+		err := tv.validateTokenType(jt)
+
+		expectValidationError(t, err, code, http.StatusUnauthorized, nil)
+	}
+}
+
+func Test_getSigningKey_UsingAccessTokenWithUnknownAudience(t *testing.T) {
+	pm, _, _, _, tv := createIDTokenValidator(t)
+	tv.accessTokens = true
+
+	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}, Audiences: []string{"https://api"}}}, nil)
+
+	jt := createAccessToken()
+	jt.Claims["aud"] = "client" // client ids are not valid access token audiences
+
+	_, sk, err := tv.getSigningKey(nil, jt)
+
+	if sk != nil {
+		t.Error("The returned signing key should be nil.")
+	}
+
+	expectValidationError(t, err, ValidationErrorAudienceNotFound, http.StatusUnauthorized, nil)
+	pm.AssertExpectations(t)
+}
+
+func Test_getSigningKey_UsingAccessTokenWithResourceAudience(t *testing.T) {
+	pm, _, sm, kp, tv := createIDTokenValidator(t)
+	tv.accessTokens = true
+
+	pm.On("get").Return([]Provider{{Issuer: "https://issuer", Audiences: []string{"https://other", "https://api"}}}, nil)
+	sm.On("getSigningKey", (*http.Request)(nil), "https://issuer", "kid").Return([]byte("key"), nil)
+	kp.On("parse", []byte("key")).Return(nil, nil)
+
+	jt := createAccessToken()
+
+	p, _, err := tv.getSigningKey(nil, jt)
+
+	if err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+
+	if p == nil || p.Issuer != "https://issuer" {
+		t.Errorf("Expected the provider https://issuer, but got %+v.", p)
+	}
+
+	pm.AssertExpectations(t)
+	sm.AssertExpectations(t)
+}
+
+func Test_validate_WhenAccessTokenIsUsedAsIDToken(t *testing.T) {
+	_, jm, _, _, tv := createIDTokenValidator(t)
+
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(createAccessToken(), nil)
+
+	_, err := tv.validate(nil, mock.Anything)
+
+	expectValidationError(t, err, ValidationErrorInvalidTokenType, http.StatusUnauthorized, nil)
+	jm.AssertExpectations(t)
+}
+
+func Test_User_ClientID(t *testing.T) {
+	u := &User{Claims: map[string]interface{}{"client_id": "client"}}
+	assert.Equal(t, "client", u.ClientID())
+
+	u = &User{Claims: map[string]interface{}{}}
+	assert.Empty(t, u.ClientID())
+}
+
+func Test_validateProvider_WithAudiencesOnly(t *testing.T) {
+	p, err := NewProvider("https://issuer", nil, AccessTokenAudiences("https://api"))
+
+	if err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+
+	assert.Equal(t, []string{"https://api"}, p.Audiences)
+}
+
+func createAccessTokenValidator(t *testing.T) *idTokenValidator {
+	_, _, _, _, tv := createIDTokenValidator(t)
+	tv.accessTokens = true
+	return tv
+}
+
+func createAccessToken() *jwtToken {
+	jt := createTokenWithClaims(jwtClaims{
+		"iss":       "https://issuer",
+		"sub":       "subject",
+		"aud":       "https://api",
+		"exp":       float64(testNow.Add(time.Hour).Unix()),
+		"iat":       float64(testNow.Unix()),
+		"jti":       "jti",
+		"client_id": "client",
+		"scope":     "read",
+	})
+	jt.Header["typ"] = "at+jwt"
+	jt.Header["kid"] = "kid"
+
+	return jt
+}
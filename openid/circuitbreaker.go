@@ -0,0 +1,251 @@
+package openid
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CircuitState represents the state of the circuit breaker guarding the endpoints of an OP.
+type CircuitState uint32
+
+// Circuit state constants.
+const (
+	CircuitClosed   CircuitState = iota // The OP endpoints are contacted normally.
+	CircuitOpen                         // The OP has been failing, its endpoints are not contacted.
+	CircuitHalfOpen                     // A single trial request is allowed to probe the OP.
+)
+
+// String returns the name of the circuit state.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+
+	return fmt.Sprintf("CircuitState(%d)", uint32(s))
+}
+
+// CircuitBreakerPolicy determines when the retrieval of the signing keys of an OP, or of its
+// configuration when introspecting tokens, stops contacting its endpoints.
+//
+// Only the failures of the OP are counted, i.e.: the configuration or jwk set endpoints could not
+// be contacted or responded with a 5xx status code. Requests cancelled by the caller and errors
+// such as invalid documents or policy violations neither open nor close the circuit.
+//
+// The FailureThreshold is the number of consecutive failures after which the circuit of the
+// OP opens. While open, requests that need new signing keys from that OP fail fast with
+// ValidationErrorCircuitOpen, or use the keys previously retrieved from it if there are any.
+//
+// The OpenDuration is how long the circuit stays open before a single trial request is
+// allowed. If the trial succeeds the circuit closes, otherwise it opens again.
+//
+// The OnStateChange function, when provided, is called every time the circuit of an OP changes
+// state. It can be used to report the state to a monitoring system. It is called synchronously
+// and must not call Configuration.CircuitState.
+type CircuitBreakerPolicy struct {
+	FailureThreshold int
+	OpenDuration     time.Duration
+	OnStateChange    func(issuer string, from CircuitState, to CircuitState)
+}
+
+// CircuitBreaker option registers the policy used to stop contacting OPs that are failing
+// repeatedly. When this option is not used the OP endpoints are contacted on every key retrieval.
+func CircuitBreaker(cbp CircuitBreakerPolicy) func(*Configuration) error {
+	return func(c *Configuration) error {
+		if cbp.FailureThreshold < 1 {
+			return &SetupError{
+				Code:    SetupErrorInvalidCircuitBreakerPolicy,
+				Message: "The circuit breaker failure threshold must be at least 1.",
+			}
+		}
+
+		if cbp.OpenDuration <= 0 {
+			return &SetupError{
+				Code:    SetupErrorInvalidCircuitBreakerPolicy,
+				Message: "The circuit breaker open duration must be greater than zero.",
+			}
+		}
+
+		c.circuitBreakerPolicy = &cbp
+		return nil
+	}
+}
+
+// CircuitState returns the current state of the circuit guarding the endpoints of the OP with
+// the given issuer. It always returns CircuitClosed when the CircuitBreaker option is not used.
+func (c *Configuration) CircuitState(issuer string) CircuitState {
+	if c.circuitBreaker == nil {
+		return CircuitClosed
+	}
+
+	return c.circuitBreaker.state(issuer)
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+type circuitBreakerKeySetProvider struct {
+	keySetGetter signingKeySetGetter
+	policy       CircuitBreakerPolicy
+	now          func() time.Time
+	mu           sync.Mutex
+	circuits     map[string]*circuit
+}
+
+func newCircuitBreakerKeySetProvider(kg signingKeySetGetter, cbp CircuitBreakerPolicy) *circuitBreakerKeySetProvider {
+	return &circuitBreakerKeySetProvider{
+		keySetGetter: kg,
+		policy:       cbp,
+		now:          time.Now,
+		circuits:     make(map[string]*circuit),
+	}
+}
+
+func (cb *circuitBreakerKeySetProvider) get(r *http.Request, issuer string) ([]signingKey, error) {
+	var sk []signingKey
+	err := cb.guard(r, issuer, func() error {
+		var err error
+		sk, err = cb.keySetGetter.get(r, issuer)
+		return err
+	})
+
+	return sk, err
+}
+
+// guard calls f, which contacts the endpoints of the OP with the given issuer, when its circuit
+// allows it and records the outcome.
+func (cb *circuitBreakerKeySetProvider) guard(r *http.Request, issuer string, f func() error) error {
+	if err := cb.allow(issuer); err != nil {
+		return err
+	}
+
+	err := f()
+
+	switch {
+	case err == nil:
+		cb.record(issuer, true)
+	case isProviderFailure(r, err):
+		cb.record(issuer, false)
+	default:
+		cb.release(issuer)
+	}
+
+	return err
+}
+
+// isProviderFailure returns true when the error is caused by the OP endpoints failing to respond
+// rather than by the caller cancelling the request or by the content of the responses.
+func isProviderFailure(r *http.Request, err error) bool {
+	if r != nil && r.Context().Err() != nil {
+		return false
+	}
+
+	ve, ok := err.(*ValidationError)
+	if !ok {
+		return false
+	}
+
+	return ve.Code == ValidationErrorGetOpenIdConfigurationFailure || ve.Code == ValidationErrorGetJwksFailure
+}
+
+func (cb *circuitBreakerKeySetProvider) state(issuer string) CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if c, ok := cb.circuits[issuer]; ok {
+		return c.state
+	}
+
+	return CircuitClosed
+}
+
+// allow returns an error if the circuit of the given issuer does not allow contacting the OP.
+func (cb *circuitBreakerKeySetProvider) allow(issuer string) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c, ok := cb.circuits[issuer]
+	if !ok {
+		return nil
+	}
+
+	switch c.state {
+	case CircuitOpen:
+		if cb.now().Sub(c.openedAt) >= cb.policy.OpenDuration {
+			c.probing = true
+			cb.transition(issuer, c, CircuitHalfOpen)
+			return nil
+		}
+	case CircuitHalfOpen:
+		// Only a single trial request is allowed in flight.
+		if !c.probing {
+			c.probing = true
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	return &ValidationError{
+		Code:       ValidationErrorCircuitOpen,
+		Message:    fmt.Sprintf("The endpoints of the provider %v are failing and will not be contacted for now.", issuer),
+		HTTPStatus: http.StatusUnauthorized,
+	}
+}
+
+func (cb *circuitBreakerKeySetProvider) record(issuer string, success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c, ok := cb.circuits[issuer]
+	if !ok {
+		c = &circuit{}
+		cb.circuits[issuer] = c
+	}
+
+	c.probing = false
+	if success {
+		c.failures = 0
+		cb.transition(issuer, c, CircuitClosed)
+		return
+	}
+
+	c.failures++
+	if c.state == CircuitHalfOpen || c.failures >= cb.policy.FailureThreshold {
+		c.openedAt = cb.now()
+		cb.transition(issuer, c, CircuitOpen)
+	}
+}
+
+// release ends the trial request, if any, without changing the state of the circuit so that
+// another one is allowed.
+func (cb *circuitBreakerKeySetProvider) release(issuer string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if c, ok := cb.circuits[issuer]; ok {
+		c.probing = false
+	}
+}
+
+func (cb *circuitBreakerKeySetProvider) transition(issuer string, c *circuit, to CircuitState) {
+	from := c.state
+	if from == to {
+		return
+	}
+
+	c.state = to
+	if cb.policy.OnStateChange != nil {
+		cb.policy.OnStateChange(issuer, from, to)
+	}
+}
@@ -0,0 +1,174 @@
+package openid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_circuitBreaker_get_OpensAfterFailureThreshold(t *testing.T) {
+	kg, cb, _ := createCircuitBreaker(t, 2)
+
+	iss := "https://issuer"
+	ee := &ValidationError{Code: ValidationErrorGetJwksFailure, HTTPStatus: http.StatusUnauthorized}
+	kg.On("get", (*http.Request)(nil), iss).Return(nil, ee).Twice()
+
+	for i := 0; i < 2; i++ {
+		_, err := cb.get(nil, iss)
+		expectValidationError(t, err, ee.Code, ee.HTTPStatus, nil)
+	}
+
+	// The circuit is now open and the key set getter is not called again.
+	_, err := cb.get(nil, iss)
+	expectValidationError(t, err, ValidationErrorCircuitOpen, http.StatusUnauthorized, nil)
+
+	if s := cb.state(iss); s != CircuitOpen {
+		t.Error("Expected circuit state", CircuitOpen, "but got", s)
+	}
+
+	kg.AssertExpectations(t)
+}
+
+func Test_circuitBreaker_get_ClosesAfterSuccessfulTrial(t *testing.T) {
+	kg, cb, now := createCircuitBreaker(t, 1)
+
+	iss := "https://issuer"
+	ee := &ValidationError{Code: ValidationErrorGetJwksFailure, HTTPStatus: http.StatusUnauthorized}
+	sk := []signingKey{{keyID: "kid", key: []byte("key")}}
+	kg.On("get", (*http.Request)(nil), iss).Return(nil, ee).Once()
+	kg.On("get", (*http.Request)(nil), iss).Return(sk, nil).Once()
+
+	var transitions []CircuitState
+	cb.policy.OnStateChange = func(i string, from CircuitState, to CircuitState) {
+		transitions = append(transitions, to)
+	}
+
+	cb.get(nil, iss)
+
+	*now = now.Add(time.Minute)
+	rsk, err := cb.get(nil, iss)
+
+	if err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+
+	if len(rsk) != 1 {
+		t.Error("Expected the signing keys to be returned, but got", rsk)
+	}
+
+	expected := []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	if len(transitions) != len(expected) {
+		t.Fatal("Expected transitions", expected, "but got", transitions)
+	}
+
+	for i, s := range expected {
+		if transitions[i] != s {
+			t.Error("Expected transition", s, "at", i, "but got", transitions[i])
+		}
+	}
+
+	kg.AssertExpectations(t)
+}
+
+func Test_circuitBreaker_get_ReopensAfterFailedTrial(t *testing.T) {
+	kg, cb, now := createCircuitBreaker(t, 3)
+
+	iss := "https://issuer"
+	ee := &ValidationError{Code: ValidationErrorGetJwksFailure, HTTPStatus: http.StatusUnauthorized}
+	kg.On("get", (*http.Request)(nil), iss).Return(nil, ee).Times(4)
+
+	for i := 0; i < 3; i++ {
+		cb.get(nil, iss)
+	}
+
+	*now = now.Add(time.Minute)
+	_, err := cb.get(nil, iss)
+	expectValidationError(t, err, ee.Code, ee.HTTPStatus, nil)
+
+	// A single failed trial opens the circuit again.
+	_, err = cb.get(nil, iss)
+	expectValidationError(t, err, ValidationErrorCircuitOpen, http.StatusUnauthorized, nil)
+
+	kg.AssertExpectations(t)
+}
+
+func Test_circuitBreaker_get_IgnoresErrorsNotCausedByTheProvider(t *testing.T) {
+	kg, cb, _ := createCircuitBreaker(t, 1)
+
+	iss := "https://issuer"
+	ee := &ValidationError{Code: ValidationErrorDecodeJwksFailure, HTTPStatus: http.StatusUnauthorized}
+	kg.On("get", (*http.Request)(nil), iss).Return(nil, ee).Twice()
+
+	for i := 0; i < 2; i++ {
+		_, err := cb.get(nil, iss)
+		expectValidationError(t, err, ee.Code, ee.HTTPStatus, nil)
+	}
+
+	if s := cb.state(iss); s != CircuitClosed {
+		t.Error("Expected circuit state", CircuitClosed, "but got", s)
+	}
+
+	kg.AssertExpectations(t)
+}
+
+func Test_circuitBreaker_get_IgnoresCancelledRequests(t *testing.T) {
+	kg, cb, now := createCircuitBreaker(t, 1)
+
+	iss := "https://issuer"
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	ee := &ValidationError{Code: ValidationErrorGetJwksFailure, HTTPStatus: http.StatusUnauthorized}
+	kg.On("get", (*http.Request)(nil), iss).Return(nil, ee).Once()
+	kg.On("get", r, iss).Return(nil, ee).Twice()
+
+	cb.get(nil, iss)
+	*now = now.Add(time.Minute)
+
+	// The trial requests are cancelled, so the circuit stays half-open and allows another trial.
+	for i := 0; i < 2; i++ {
+		_, err := cb.get(r, iss)
+		expectValidationError(t, err, ee.Code, ee.HTTPStatus, nil)
+	}
+
+	if s := cb.state(iss); s != CircuitHalfOpen {
+		t.Error("Expected circuit state", CircuitHalfOpen, "but got", s)
+	}
+
+	kg.AssertExpectations(t)
+}
+
+func Test_getSigningKey_WhenCircuitIsOpen_UsesFlushedKeys(t *testing.T) {
+	keyGetter, keyCache := createSigningKeyProvider(t)
+
+	iss := "issuer"
+	kid := "kid1"
+	key := "signingKey"
+	keyCache.jwksMap[iss] = []signingKey{{keyID: kid, key: []byte(key)}}
+	ee := &ValidationError{Code: ValidationErrorCircuitOpen, HTTPStatus: http.StatusUnauthorized}
+	keyGetter.On("get", (*http.Request)(nil), iss).Return(nil, ee).Once()
+
+	keyCache.flushCachedSigningKeys(iss)
+
+	expectKey(t, keyCache, iss, kid, key)
+	keyGetter.AssertExpectations(t)
+}
+
+func Test_CircuitBreaker_WithInvalidPolicy(t *testing.T) {
+	_, err := NewConfiguration(CircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 0, OpenDuration: time.Second}))
+	expectSetupError(t, err, SetupErrorInvalidCircuitBreakerPolicy)
+
+	_, err = NewConfiguration(CircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 1}))
+	expectSetupError(t, err, SetupErrorInvalidCircuitBreakerPolicy)
+}
+
+func createCircuitBreaker(t *testing.T, threshold int) (*mockSigningKeySetGetter, *circuitBreakerKeySetProvider, *time.Time) {
+	kg := &mockSigningKeySetGetter{}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cb := newCircuitBreakerKeySetProvider(kg, CircuitBreakerPolicy{FailureThreshold: threshold, OpenDuration: time.Minute})
+	cb.now = func() time.Time { return now }
+
+	return kg, cb, &now
+}
@@ -0,0 +1,67 @@
+package openid
+
+import (
+	"net/http"
+)
+
+// The ClaimsValidator validates the claims of the tokens in addition to the validation
+// performed by the middleware. It is called after the token signature is verified, with
+// the token claims and the request being authenticated.
+//
+// ValidateClaims returns an error if the token must be rejected. Errors of the type
+// *ValidationError are forwarded as they are to the ErrorHandlerFunc, other errors are wrapped
+// in a *ValidationError with the code ValidationErrorClaimsValidationFailure.
+type ClaimsValidator interface {
+	ValidateClaims(claims map[string]interface{}, r *http.Request) error
+}
+
+// The ClaimsValidatorFunc is an adapter to allow the use of functions as ClaimsValidator.
+type ClaimsValidatorFunc func(claims map[string]interface{}, r *http.Request) error
+
+// ValidateClaims calls f(claims, r)
+func (f ClaimsValidatorFunc) ValidateClaims(claims map[string]interface{}, r *http.Request) error {
+	return f(claims, r)
+}
+
+// ClaimsValidation option registers the validators run against the claims of all the tokens
+// validated with the Configuration. The validators registered with a Provider are run after
+// these ones, for the tokens issued by that Provider.
+func ClaimsValidation(cvs ...ClaimsValidator) func(*Configuration) error {
+	return func(c *Configuration) error {
+		tv := c.tokenValidator.(*idTokenValidator)
+		tv.claimsValidators = append(tv.claimsValidators, cvs...)
+		return nil
+	}
+}
+
+// validateClaims runs the validators registered with the Configuration and the ones
+// registered with the given provider, stopping at the first one that fails.
+func (tv *idTokenValidator) validateClaims(r *http.Request, jt *jwtToken, p *Provider) error {
+	cvs := tv.claimsValidators
+	if p != nil {
+		cvs = append(cvs[:len(cvs):len(cvs)], p.ClaimsValidators...)
+	}
+
+	if len(cvs) == 0 {
+		return nil
+	}
+
+	claims := jt.Claims
+
+	for _, cv := range cvs {
+		if err := cv.ValidateClaims(claims, r); err != nil {
+			if verr, ok := err.(*ValidationError); ok {
+				return verr
+			}
+
+			return &ValidationError{
+				Code:       ValidationErrorClaimsValidationFailure,
+				Message:    "The token claims were rejected: " + err.Error(),
+				Err:        err,
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package openid
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_validateClaims_WhenNoValidatorIsRegistered(t *testing.T) {
+	_, _, _, _, tv := createIDTokenValidator(t)
+
+	if err := tv.validateClaims(nil, createTokenWithClaims(jwtClaims{}), &Provider{}); err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+}
+
+func Test_validateClaims_RunsGlobalThenProviderValidators(t *testing.T) {
+	_, _, _, _, tv := createIDTokenValidator(t)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	var calls []string
+
+	tv.claimsValidators = []ClaimsValidator{ClaimsValidatorFunc(func(claims map[string]interface{}, r *http.Request) error {
+		if claims["hd"] != "example.com" {
+			t.Error("The validator should have received the token claims.")
+		}
+
+		if r != req {
+			t.Error("The validator should have received the request.")
+		}
+
+		calls = append(calls, "global")
+		return nil
+	})}
+
+	p := &Provider{ClaimsValidators: []ClaimsValidator{ClaimsValidatorFunc(func(claims map[string]interface{}, r *http.Request) error {
+		calls = append(calls, "provider")
+		return nil
+	})}}
+
+	if err := tv.validateClaims(req, createTokenWithClaims(jwtClaims{"hd": "example.com"}), p); err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+
+	if len(calls) != 2 || calls[0] != "global" || calls[1] != "provider" {
+		t.Error("Expected the global and then the provider validators to be called, but got", calls)
+	}
+
+	if len(tv.claimsValidators) != 1 {
+		t.Error("The provider validators should not have been added to the global ones.")
+	}
+}
+
+func Test_validateClaims_WhenValidatorFails(t *testing.T) {
+	_, _, _, _, tv := createIDTokenValidator(t)
+	ee := errors.New("email not verified")
+
+	p := &Provider{ClaimsValidators: []ClaimsValidator{
+		ClaimsValidatorFunc(func(claims map[string]interface{}, r *http.Request) error { return ee }),
+		ClaimsValidatorFunc(func(claims map[string]interface{}, r *http.Request) error {
+			t.Error("The validators after a failure should not have been called.")
+			return nil
+		}),
+	}}
+
+	err := tv.validateClaims(nil, createTokenWithClaims(jwtClaims{}), p)
+
+	expectValidationError(t, err, ValidationErrorClaimsValidationFailure, http.StatusUnauthorized, ee)
+}
+
+func Test_validateClaims_WhenValidatorReturnsValidationError(t *testing.T) {
+	_, _, _, _, tv := createIDTokenValidator(t)
+	ee := &ValidationError{Code: ValidationErrorClaimsValidationFailure, HTTPStatus: http.StatusForbidden}
+	tv.claimsValidators = []ClaimsValidator{ClaimsValidatorFunc(func(claims map[string]interface{}, r *http.Request) error { return ee })}
+
+	err := tv.validateClaims(nil, createTokenWithClaims(jwtClaims{}), nil)
+
+	expectValidationError(t, err, ee.Code, ee.HTTPStatus, nil)
+}
+
+func Test_validate_WhenClaimsValidatorFails(t *testing.T) {
+	_, jm, _, _, tv := createIDTokenValidator(t)
+	ee := errors.New("tenant not allowed")
+	tv.claimsValidators = []ClaimsValidator{ClaimsValidatorFunc(func(claims map[string]interface{}, r *http.Request) error { return ee })}
+
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(createTokenWithClaims(jwtClaims{"tid": "blocked"}), nil)
+
+	_, err := tv.validate(nil, mock.Anything)
+
+	expectValidationError(t, err, ValidationErrorClaimsValidationFailure, http.StatusUnauthorized, ee)
+	jm.AssertExpectations(t)
+}
+
+func Test_ClaimsValidation_AppendsValidators(t *testing.T) {
+	c, err := NewConfiguration(ProvidersGetter(func() ([]Provider, error) { return nil, nil }),
+		ClaimsValidation(ClaimsValidatorFunc(func(map[string]interface{}, *http.Request) error { return nil })),
+		ClaimsValidation(ClaimsValidatorFunc(func(map[string]interface{}, *http.Request) error { return nil })))
+
+	if err != nil {
+		t.Fatal("An error was returned but not expected.", err)
+	}
+
+	if n := len(c.tokenValidator.(*idTokenValidator).claimsValidators); n != 2 {
+		t.Error("Expected 2 claims validators, but got", n)
+	}
+}
@@ -53,6 +53,15 @@ func (httpProv *httpConfigurationProvider) get(r *http.Request, issuer string) (
 
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return config, &ValidationError{
+			Code:       ValidationErrorGetOpenIdConfigurationFailure,
+			Message:    fmt.Sprintf("Failure while contacting the configuration endpoint %v.", configurationURI),
+			Err:        fmt.Errorf("the endpoint responded with the status %v", resp.Status),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
 	if config, err = httpProv.decoder.decode(resp.Body); err != nil {
 		return config, &ValidationError{
 			Code:       ValidationErrorDecodeOpenIdConfigurationFailure,
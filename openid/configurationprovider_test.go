@@ -97,7 +97,7 @@ func TestConfigurationProvider_Get_WhenDecodeResponseSucceeds(t *testing.T) {
 	configDecoder := &mockConfigurationDecoder{}
 
 	configurationProvider := httpConfigurationProvider{httpGetter, configDecoder}
-	config := configuration{"testissuer", "https://testissuer/jwk"}
+	config := configuration{Issuer: "testissuer", JwksURI: "https://testissuer/jwk"}
 	respBody := "openid configuration"
 	resp := &http.Response{Body: testBody{bytes.NewBufferString(respBody)}}
 	httpGetter.On("get", (*http.Request)(nil), mock.Anything).Return(resp, nil)
@@ -149,3 +149,17 @@ func ioReaderMatcher(t *testing.T, expectedContent string) func(r io.Reader) boo
 		return res
 	}
 }
+
+func TestConfigurationProvider_Get_WhenEndpointFails(t *testing.T) {
+	httpGetter := &mockHTTPGetter{}
+	configurationProvider := httpConfigurationProvider{getter: httpGetter}
+
+	resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable", Body: testBody{bytes.NewBufferString("")}}
+	httpGetter.On("get", (*http.Request)(nil), mock.Anything).Return(resp, nil)
+
+	_, e := configurationProvider.get(nil, "issuer")
+
+	expectValidationError(t, e, ValidationErrorGetOpenIdConfigurationFailure, http.StatusUnauthorized, nil)
+
+	httpGetter.AssertExpectations(t)
+}
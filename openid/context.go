@@ -0,0 +1,78 @@
+package openid
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	rawTokenContextKey
+)
+
+// Middleware returns the Authenticate middleware as a standard func(http.Handler) http.Handler
+// constructor, composing with the routers and middleware chains compatible with net/http.
+// The next handler retrieves the authenticated user with UserFromContext.
+func Middleware(conf *Configuration) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return Authenticate(conf, h)
+	}
+}
+
+// UserFromContext returns the User stored in the context by the middlewares of this package
+// and whether it was found.
+func UserFromContext(ctx context.Context) (*User, bool) {
+	u, ok := ctx.Value(userContextKey).(*User)
+	return u, ok && u != nil
+}
+
+// RawTokenFromContext returns the token the user stored in the context was authenticated with
+// and whether it was found.
+func RawTokenFromContext(ctx context.Context) (string, bool) {
+	t, ok := ctx.Value(rawTokenContextKey).(string)
+	return t, ok && t != ""
+}
+
+// ContextWithUser returns a copy of the context storing the user and the token it was
+// authenticated with. It allows the users authenticated with a Validator to be propagated the
+// same way as the ones authenticated by the middlewares.
+func ContextWithUser(ctx context.Context, u *User) context.Context {
+	ctx = context.WithValue(ctx, userContextKey, u)
+	if u != nil && u.rawToken != "" {
+		ctx = context.WithValue(ctx, rawTokenContextKey, u.rawToken)
+	}
+
+	return ctx
+}
+
+// userMiddleware returns a middleware that verifies the User stored in the request context with
+// the given function before calling the next handler. The errors are handled by the
+// ErrorHandlerFunc of the Configuration. The function receives a nil User when the request does
+// not carry one, i.e.: when the middleware is not stacked after Authenticate, AuthenticateUser or
+// Middleware or when the authentication failed and the ErrorHandlerFunc let the request continue.
+func userMiddleware(conf *Configuration, verify func(u *User, r *http.Request) error) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u, _ := UserFromContext(r.Context())
+			if err := verify(u, r); err != nil {
+				if conf.getErrorHandler()(err, w, r) {
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestWithUser returns a shallow copy of the request with the user stored in its context.
+// The request is returned unchanged when the user is nil.
+func requestWithUser(r *http.Request, u *User) *http.Request {
+	if u == nil || r == nil {
+		return r
+	}
+
+	return r.WithContext(ContextWithUser(r.Context(), u))
+}
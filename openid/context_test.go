@@ -0,0 +1,115 @@
+package openid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_Authenticate_StoresUserInContext(t *testing.T) {
+	vm, c := createConfiguration(t, nil, getIDTokenReturnsSuccess)
+	vm.On("validate", mock.Anything, idToken).Return(createRawToken(), nil)
+
+	called := false
+	h := Authenticate(c, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		expectUserInContext(t, r.Context())
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.True(t, called)
+}
+
+func Test_AuthenticateUser_StoresUserInContext(t *testing.T) {
+	vm, c := createConfiguration(t, nil, getIDTokenReturnsSuccess)
+	vm.On("validate", mock.Anything, idToken).Return(createRawToken(), nil)
+
+	called := false
+	h := AuthenticateUser(c, UserHandlerFunc(func(u *User, w http.ResponseWriter, r *http.Request) {
+		called = true
+		cu := expectUserInContext(t, r.Context())
+		assert.Equal(t, u, cu)
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.True(t, called)
+}
+
+func Test_Middleware(t *testing.T) {
+	vm, c := createConfiguration(t, nil, getIDTokenReturnsSuccess)
+	vm.On("validate", mock.Anything, idToken).Return(createRawToken(), nil)
+
+	called := false
+	h := Middleware(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		expectUserInContext(t, r.Context())
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.True(t, called)
+}
+
+func Test_Authenticate_WhenValidationFailsAndErrorHandlerContinues(t *testing.T) {
+	vm, c := createConfiguration(t, errorHandlerContinue, getIDTokenReturnsSuccess)
+	vm.On("validate", mock.Anything, idToken).Return(nil, &ValidationError{Code: ValidationErrorJwtValidationFailure})
+
+	called := false
+	h := Authenticate(c, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		_, found := UserFromContext(r.Context())
+		assert.False(t, found)
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.True(t, called)
+}
+
+func Test_UserFromContext_WhenContextIsEmpty(t *testing.T) {
+	u, found := UserFromContext(context.Background())
+	assert.Nil(t, u)
+	assert.False(t, found)
+
+	rt, found := RawTokenFromContext(context.Background())
+	assert.Empty(t, rt)
+	assert.False(t, found)
+}
+
+func Test_ContextWithUser(t *testing.T) {
+	u, err := newUser(createRawToken())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectUserInContext(t, ContextWithUser(context.Background(), u))
+
+	_, found := UserFromContext(ContextWithUser(context.Background(), nil))
+	assert.False(t, found)
+}
+
+func createRawToken() *jwtToken {
+	jt := createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "SUB1"})
+	jt.Raw = idToken
+	return jt
+}
+
+func expectUserInContext(t *testing.T, ctx context.Context) *User {
+	u, found := UserFromContext(ctx)
+	if !found {
+		t.Fatal("The user was not found in the context.")
+	}
+
+	assert.Equal(t, "SUB1", u.ID)
+
+	rt, found := RawTokenFromContext(ctx)
+	assert.True(t, found)
+	assert.Equal(t, idToken, rt)
+	return u
+}
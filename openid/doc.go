@@ -20,15 +20,86 @@ of them you will need an instance of the Configuration type, to create that you
        func ErrorHandler(eh ErrorHandlerFunc) func(*Configuration) error
        func ProvidersGetter(pg GetProvidersFunc) func(*Configuration) error
        func HTTPGetter(hg HTTPGetFunc) func(*Configuration) error
+       func HTTPRetry(rp RetryPolicy) func(*Configuration) error
+       func CircuitBreaker(cbp CircuitBreakerPolicy) func(*Configuration) error
+       func JwksURIRestrictions(jp JwksURIPolicy) func(*Configuration) error
+       func Leeway(d time.Duration) func(*Configuration) error
+       func Clock(now func() time.Time) func(*Configuration) error
+       func TokenAge(tp TokenAgePolicy) func(*Configuration) error
+       func StrictValidation() func(*Configuration) error
+       func NonceVerification(nv NonceVerifier) func(*Configuration) error
+       func ClaimsValidation(cvs ...ClaimsValidator) func(*Configuration) error
+       func AccessTokenValidation() func(*Configuration) error
+       func AuthorizationPolicy(rule string) func(*Configuration) error
+       func TokenRevocation(rs RevocationStore) func(*Configuration) error
+       func TokenIntrospection(ip IntrospectionPolicy) func(*Configuration) error
+       func TokenDecryption(dp DecryptionPolicy) func(*Configuration) error
+       func IDTokenGetter(tg GetIDTokenFunc) func(*Configuration) error
 
        // extension points:
 
        type ErrorHandlerFunc func(error, http.ResponseWriter, *http.Request) bool
        type GetProvidersFunc func() ([]Provider, error)
        type HTTPGetFunc func(r *http.Request, url string) (*http.Response, error)
+       type GetIDTokenFunc func(r *http.Request) (token string, err error)
 
 The Example below demonstrates these elements working together.
 
+Tokens received outside of HTTP requests, for instance through message queues or gRPC metadata, are
+validated with a Validator sharing the providers, caches and options of the Configuration:
+
+       func NewValidator(conf *Configuration) *Validator
+       func (v *Validator) Validate(ctx context.Context, rawToken string) (*User, error)
+
+The AuthenticateWithClaims middleware, available with Go 1.18 or later, also decodes the token claims into
+a type of the application, using its JSON tags, and forwards them to the next handler:
+
+       func AuthenticateWithClaims[T any](conf *Configuration, h ClaimsHandler[T]) http.Handler
+
+The RequireTokenAge middleware verifies, for individual routes, that the token and the authentication it
+represents are recent enough, see TokenAgePolicy. It reads the User stored in the request context and is
+stacked after Middleware, Authenticate or AuthenticateUser:
+
+       func RequireTokenAge(conf *Configuration, tp TokenAgePolicy) func(http.Handler) http.Handler
+
+ http.Handle("/settings", openid.Middleware(c)(openid.RequireTokenAge(c, tp)(http.HandlerFunc(myHandler))))
+
+The RequireAllScopes and RequireAnyScope middlewares verify the scopes granted to the token, found in its
+'scope' or 'scp' claim. Like RequireTokenAge they are stacked after the authentication. Requests missing the
+scopes fail with HTTP status 403/Forbidden and an RFC 6750 'insufficient_scope' challenge:
+
+       func RequireAllScopes(conf *Configuration, scopes []string) func(http.Handler) http.Handler
+       func RequireAnyScope(conf *Configuration, scopes []string) func(http.Handler) http.Handler
+
+The RequireAnyRole and RequireAllRoles middlewares verify the roles of the user, found in the claims
+registered as the RolesClaims of the Provider, 'roles' by default. Requests missing the roles fail with HTTP
+status 403/Forbidden:
+
+       func RequireAnyRole(conf *Configuration, roles []string) func(http.Handler) http.Handler
+       func RequireAllRoles(conf *Configuration, roles []string) func(http.Handler) http.Handler
+
+ http.Handle("/admin", openid.Middleware(c)(openid.RequireAnyScope(c, []string{"admin"})(
+     openid.RequireAnyRole(c, []string{"admin"})(http.HandlerFunc(myHandler)))))
+
+The authorization rules can also be written as expressions compiled with CompilePolicy, see Policy, and
+registered with the AuthorizationPolicy option for all the routes or with the AuthorizePolicy middleware
+for individual routes:
+
+       func AuthorizePolicy(conf *Configuration, p *Policy) func(http.Handler) http.Handler
+
+ p := openid.MustCompilePolicy(`claims.email_verified == true && "admin" in claims.groups`)
+ http.Handle("/admin", openid.Middleware(c)(openid.AuthorizePolicy(c, p)(http.HandlerFunc(myHandler))))
+
+The AuthorizeDecision middleware delegates the authorization to a PolicyDecider, such as the in-process
+LocalPolicyDecider or the HTTPPolicyDecider calling an external policy engine:
+
+       func AuthorizeDecision(conf *Configuration, pd PolicyDecider, headers []string) func(http.Handler) http.Handler
+
+The RequireSingleUse middleware allows each token to be used only once, recording the tokens used in a
+ReplayStore such as the MemoryReplayStore:
+
+       func RequireSingleUse(conf *Configuration, rs ReplayStore) func(http.Handler) http.Handler
+
 Token Parsing
 
 Both Authenticate and AuthenticateUser middlewares expect the incoming requests to have an HTTP
@@ -41,6 +112,17 @@ By default, requests that do not contain an Authorization header with this conte
 to the next HTTP handler in the pipeline, instead they will fail back to the client with HTTP status
 400/Bad Request.
 
+The token can be read from other parts of the requests by registering a GetIDTokenFunc with the
+IDTokenGetter option. The IDTokenFromCookie, IDTokenFromQuery, IDTokenFromHeader and IDTokenFromForm
+functions return getters reading it from a cookie, a query parameter, a custom header or the 'access_token'
+parameter of form encoded bodies. IDTokenFromAny combines them, rejecting the requests presenting the token
+more than once:
+
+ c, _ := openid.NewConfiguration(openid.ProvidersGetter(myGetProviders),
+                                 openid.IDTokenGetter(openid.IDTokenFromAny(
+                                     openid.IDTokenFromAuthorizationHeader(),
+                                     openid.IDTokenFromCookie("id_token"))))
+
 Token Validation
 
 Once parsed the ID Token will be validated:
@@ -51,6 +133,9 @@ Once parsed the ID Token will be validated:
   4) Is the token valid at the time ('not use before' and 'expire at' claims)?
   5) Is the token signed accordingly?
 
+The time based claims are validated against the time returned by the function registered with the Clock
+option, time.Now by default, tolerating the clock skew registered with the Leeway option or the Provider Leeway.
+
 The signature validation is done with the public keys retrieved from the jwks_uri published by the OP in
 its OIDC metadata (https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata).
 
@@ -72,6 +157,18 @@ one of the ClientIDs of the respective provider then the token is considered val
 In code above only tokens with Issuer claim ('iss') https://accounts.google.com and Audiences claim
 ('aud') containing "407408718192.apps.googleusercontent.com" can be valid.
 
+With the AccessTokenValidation option the middlewares validate OAuth 2.0 JWT access tokens (RFC 9068)
+instead of ID Tokens. The tokens must then have the type 'at+jwt' and their audiences are verified against
+the Audiences of the providers, which can be set with the AccessTokenAudiences option of NewProvider.
+
+With the TokenDecryption option the middlewares also accept ID Tokens encrypted to the client, signed and
+then encrypted as JWEs. They are decrypted with the keys of the DecryptionPolicy, restricted to the key
+management and content encryption algorithms it allows, before the signed token is validated.
+
+NewProvider validates that the issuer is an https URL with a host and without query or fragment
+components. The NormalizeIssuer and AllowInsecureLocalhost options can be given to NewProvider to
+respectively normalize the issuer before validating it and accept http issuers of OPs running locally.
+
 By default, when the token validation fails for any reason the requests will not be forwarded to the next
 handler in the pipeline, instead they will fail back to the client with HTTP status 401/Unauthorized.
 
@@ -127,5 +224,17 @@ You can also make use of the function adapter UserHandlerFunc as shown in the ex
  }
 
  http.Handle("/user", openid.AuthenticateUser(c, openid.UserHandlerFunc(myHandlerWithUser)))
+
+Both middlewares also store the User and the raw token in the context of the request forwarded to the next
+handler, where they are retrieved with UserFromContext and RawTokenFromContext. The Middleware function
+returns the Authenticate middleware as a standard func(http.Handler) http.Handler constructor, composing
+with any router or middleware chain compatible with net/http:
+
+ func myHandler(w http.ResponseWriter, r *http.Request) {
+     u, _ := openid.UserFromContext(r.Context())
+     fmt.Fprintf(w, "Authenticated! The user is %+v.", u)
+ }
+
+ http.Handle("/user", openid.Middleware(c)(http.HandlerFunc(myHandler)))
 */
 package openid
@@ -3,8 +3,6 @@ package openid
 import (
 	"fmt"
 	"net/http"
-
-	"github.com/dgrijalva/jwt-go"
 )
 
 // SetupErrorCode is the type of error code that can
@@ -13,9 +11,16 @@ type SetupErrorCode uint32
 
 // Setup error constants.
 const (
-	SetupErrorInvalidIssuer           SetupErrorCode = iota // Invalid issuer provided during setup.
-	SetupErrorInvalidClientIDs                              // Invalid client id collection provided during setup.
-	SetupErrorEmptyProviderCollection                       // Empty collection of providers provided during setup.
+	SetupErrorInvalidIssuer               SetupErrorCode = iota // Invalid issuer provided during setup.
+	SetupErrorInvalidClientIDs                                  // Invalid client id collection provided during setup.
+	SetupErrorEmptyProviderCollection                           // Empty collection of providers provided during setup.
+	SetupErrorInvalidRetryPolicy                                // Invalid retry policy provided during setup.
+	SetupErrorInvalidCircuitBreakerPolicy                       // Invalid circuit breaker policy provided during setup.
+	SetupErrorInvalidLeeway                                     // Invalid leeway provided during setup.
+	SetupErrorInvalidPolicy                                     // Invalid authorization policy provided during setup.
+	SetupErrorInvalidIntrospectionPolicy                        // Invalid introspection policy provided during setup.
+	SetupErrorInvalidDecryptionPolicy                           // Invalid decryption policy provided during setup.
+	SetupErrorInvalidIDTokenGetter                              // Invalid id token getter provided during setup.
 )
 
 // ValidationErrorCode is the type of error code that can
@@ -48,6 +53,58 @@ const (
 	ValidationErrorSubjectNotFound                                               // Token missing the 'sub' claim.
 	ValidationErrorIdTokenEmpty                                                  // Empty ID token.
 	ValidationErrorEmptyProviders                                                // Empty collection of providers.
+	ValidationErrorCircuitOpen                                                   // The provider circuit is open, its endpoints are not contacted.
+	ValidationErrorJwksURIInvalid                                                // The jwks_uri is not a valid URL or its host could not be resolved.
+	ValidationErrorJwksURIInsecure                                               // The jwks_uri does not use https.
+	ValidationErrorJwksURIHostNotAllowed                                         // The jwks_uri points to a host that is not allowed.
+	ValidationErrorJwksURIPrivateAddress                                         // The jwks_uri resolves to a private address.
+	ValidationErrorJwksURITooManyRedirects                                       // The jwks_uri redirected too many times.
+	ValidationErrorIssuedAtNotFound                                              // Token missing the 'iat' claim.
+	ValidationErrorTokenTooOld                                                   // The token was issued too long ago.
+	ValidationErrorTokenLifetimeTooLong                                          // The token lifetime, from 'iat' to 'exp', is too long.
+	ValidationErrorAuthTimeNotFound                                              // Token missing the 'auth_time' claim.
+	ValidationErrorAuthenticationTooOld                                          // The end-user authenticated too long ago.
+	ValidationErrorExpirationNotFound                                            // Token missing the 'exp' claim.
+	ValidationErrorAuthorizedPartyNotFound                                       // Token with multiple audiences missing the 'azp' claim.
+	ValidationErrorInvalidAuthorizedParty                                        // Unexpected token authorized party.
+	ValidationErrorInvalidSigningAlgorithm                                       // Unexpected token signing algorithm.
+	ValidationErrorNonceNotFound                                                 // Token missing the 'nonce' claim.
+	ValidationErrorInvalidNonce                                                  // Unexpected token nonce.
+	ValidationErrorAccessTokenHashNotFound                                       // Token missing the 'at_hash' claim.
+	ValidationErrorInvalidAccessTokenHash                                        // The 'at_hash' claim does not match the access token.
+	ValidationErrorCodeHashNotFound                                              // Token missing the 'c_hash' claim.
+	ValidationErrorInvalidCodeHash                                               // The 'c_hash' claim does not match the authorization code.
+	ValidationErrorClaimsValidationFailure                                       // A claims validator rejected the token.
+	ValidationErrorClaimsDecodeFailure                                           // Failure while decoding the token claims.
+	ValidationErrorInvalidTokenType                                              // Unexpected token type, i.e.: an access token used as an ID Token or vice versa.
+	ValidationErrorClientIDNotFound                                              // Token missing the 'client_id' claim.
+	ValidationErrorJwtIDNotFound                                                 // Token missing the 'jti' claim.
+	ValidationErrorTokenRevoked                                                  // The token was revoked.
+	ValidationErrorRevocationCheckFailure                                        // Failure while checking whether the token was revoked.
+	ValidationErrorTokenReplayed                                                 // The single use token was already used.
+	ValidationErrorReplayCheckFailure                                            // Failure while checking whether the token was already used.
+	ValidationErrorIntrospectionNotSupported                                     // The provider does not publish an introspection_endpoint.
+	ValidationErrorIntrospectionFailure                                          // Failure while introspecting the token.
+	ValidationErrorTokenInactive                                                 // The introspected token is not active.
+	ValidationErrorUnsupportedEncryptionAlgorithm                                // The token is encrypted with an algorithm not allowed.
+	ValidationErrorDecryptionFailure                                             // The encrypted token could not be decrypted.
+	ValidationErrorTokenNotFound                                                 // The token was not found on the request.
+	ValidationErrorAmbiguousToken                                                // The token was presented more than once on the request.
+	ValidationErrorInvalidConfigurationIssuer                                    // The issuer of the OP configuration does not match the provider issuer.
+	ValidationErrorInvalidRequestBody                                            // The request body could not be parsed.
+)
+
+// AuthorizationErrorCode is the type of error code that can
+// be returned by the operations done during the authorization of authenticated users.
+type AuthorizationErrorCode uint32
+
+// Authorization error constants.
+const (
+	AuthorizationErrorInsufficientScope AuthorizationErrorCode = iota // The token does not have the required scopes.
+	AuthorizationErrorMissingRole                                     // The user does not have the required roles.
+	AuthorizationErrorPolicyDenied                                    // The authorization policy denied the access.
+	AuthorizationErrorDecisionDenied                                  // The policy decider denied the access.
+	AuthorizationErrorDecisionFailure                                 // The policy decider failed to make a decision.
 )
 
 const setupErrorMessagePrefix string = "Setup Error."
@@ -75,6 +132,19 @@ type ValidationError struct {
 	HTTPStatus int
 }
 
+// AuthorizationError represents the error returned by the authorization middlewares when
+// the authenticated user is not allowed to access the resource.
+//
+// The Challenge, when not empty, is the value of the WWW-Authenticate header to be added to
+// the response, for instance an RFC 6750 'insufficient_scope' challenge.
+type AuthorizationError struct {
+	Err        error
+	Code       AuthorizationErrorCode
+	Message    string
+	HTTPStatus int
+	Challenge  string
+}
+
 // The ErrorHandlerFunc represents the function used to handle errors during token
 // validation. Applications can have their own implementation of this function and
 // register it using the ErrorHandler option. Through this extension point applications
@@ -89,38 +159,64 @@ func (ve ValidationError) Error() string {
 	return fmt.Sprintf("Validation error. %v", ve.Message)
 }
 
-// jwtErrorToOpenIDError converts errors of the type *jwt.ValidationError returned during token validation into errors of type *ValidationError
+// Error returns a formatted string containing the error Message.
+func (ae AuthorizationError) Error() string {
+	return fmt.Sprintf("Authorization error. %v", ae.Message)
+}
+
+// jwtErrorToOpenIDError converts errors of the type *jwtError returned during token parsing into errors of type *ValidationError.
+// The errors of type *ValidationError returned while retrieving the signing key, such as when the token issuer is not
+// registered, are returned unchanged.
 func jwtErrorToOpenIDError(e error) *ValidationError {
-	if jwtError, ok := e.(*jwt.ValidationError); ok {
-		if (jwtError.Errors & (jwt.ValidationErrorNotValidYet | jwt.ValidationErrorExpired | jwt.ValidationErrorSignatureInvalid)) != 0 {
-			return &ValidationError{
-				Code:       ValidationErrorJwtValidationFailure,
-				Message:    "Jwt token validation failed.",
-				HTTPStatus: http.StatusUnauthorized,
-			}
+	jwtErr, ok := e.(*jwtError)
+	if !ok {
+		return &ValidationError{
+			Code:       ValidationErrorJwtValidationUnknownFailure,
+			Message:    "Jwt token validation failed with unknown error.",
+			Err:        e,
+			HTTPStatus: http.StatusInternalServerError,
 		}
+	}
 
-		if (jwtError.Errors & jwt.ValidationErrorMalformed) != 0 {
-			return &ValidationError{
-				Code:       ValidationErrorJwtValidationFailure,
-				Message:    "Jwt token validation failed.",
-				HTTPStatus: http.StatusBadRequest,
-			}
+	switch jwtErr.Kind {
+	case jwtErrorMalformed:
+		return &ValidationError{
+			Code:       ValidationErrorJwtValidationFailure,
+			Message:    "Jwt token validation failed. The token is malformed.",
+			Err:        jwtErr.Err,
+			HTTPStatus: http.StatusBadRequest,
+		}
+	case jwtErrorUnsupportedAlgorithm:
+		return &ValidationError{
+			Code:       ValidationErrorInvalidSigningAlgorithm,
+			Message:    "Jwt token validation failed. The token signing algorithm is not supported.",
+			Err:        jwtErr.Err,
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	case jwtErrorUnverifiable:
+		if verr, ok := jwtErr.Err.(*ValidationError); ok {
+			return verr
 		}
 
-		if (jwtError.Errors & jwt.ValidationErrorUnverifiable) != 0 {
-			// TODO: improve this once https://github.com/dgrijalva/jwt-go/issues/108 is resolved.
-			// Currently jwt.Parse does not surface errors returned by the KeyFunc.
-			return &ValidationError{
-				Code:       ValidationErrorJwtValidationFailure,
-				Message:    jwtError.Error(),
-				HTTPStatus: http.StatusUnauthorized,
-			}
+		return &ValidationError{
+			Code:       ValidationErrorJwtValidationFailure,
+			Message:    fmt.Sprintf("Jwt token validation failed. The signing key could not be retrieved: %v", jwtErr.Err),
+			Err:        jwtErr.Err,
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	case jwtErrorSignatureInvalid:
+		return &ValidationError{
+			Code:       ValidationErrorJwtValidationFailure,
+			Message:    "Jwt token validation failed. The token signature is invalid.",
+			Err:        jwtErr.Err,
+			HTTPStatus: http.StatusUnauthorized,
 		}
 	}
+
 	return &ValidationError{
 		Code:       ValidationErrorJwtValidationUnknownFailure,
 		Message:    "Jwt token validation failed with unknown error.",
+		Err:        jwtErr,
 		HTTPStatus: http.StatusInternalServerError,
 	}
 }
@@ -128,6 +224,12 @@ func jwtErrorToOpenIDError(e error) *ValidationError {
 func validationErrorToHTTPStatus(e error, rw http.ResponseWriter, req *http.Request) (halt bool) {
 	if verr, ok := e.(*ValidationError); ok {
 		http.Error(rw, verr.Message, verr.HTTPStatus)
+	} else if aerr, ok := e.(*AuthorizationError); ok {
+		if aerr.Challenge != "" {
+			rw.Header().Set("WWW-Authenticate", aerr.Challenge)
+		}
+
+		http.Error(rw, aerr.Message, aerr.HTTPStatus)
 	} else {
 		rw.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(rw, e.Error())
@@ -1,6 +1,7 @@
 package openid_test
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
@@ -53,3 +54,79 @@ func getProviders_googlePlayground() ([]openid.Provider, error) {
 
 	return []openid.Provider{provider}, nil
 }
+
+// This example demonstrates how to register custom claims validators. The validators registered
+// with the ClaimsValidation option run for all the tokens while the ones registered with a Provider
+// only run for the tokens issued by that Provider.
+func ExampleClaimsValidation() {
+	emailVerified := openid.ClaimsValidatorFunc(func(claims map[string]interface{}, r *http.Request) error {
+		if v, _ := claims["email_verified"].(bool); !v {
+			return fmt.Errorf("the email of the user %v is not verified", claims["sub"])
+		}
+
+		return nil
+	})
+
+	hostedDomain := openid.ClaimsValidatorFunc(func(claims map[string]interface{}, r *http.Request) error {
+		if claims["hd"] != "example.com" {
+			return fmt.Errorf("the hosted domain %v is not allowed", claims["hd"])
+		}
+
+		return nil
+	})
+
+	getProviders := func() ([]openid.Provider, error) {
+		provider, err := openid.NewProvider("https://accounts.google.com", []string{"407408718192.apps.googleusercontent.com"})
+
+		if err != nil {
+			return nil, err
+		}
+
+		provider.ClaimsValidators = []openid.ClaimsValidator{hostedDomain}
+
+		return []openid.Provider{provider}, nil
+	}
+
+	configuration, err := openid.NewConfiguration(openid.ProvidersGetter(getProviders),
+		openid.ClaimsValidation(emailVerified))
+
+	if err != nil {
+		panic(err)
+	}
+
+	http.Handle("/user", openid.AuthenticateUser(configuration, openid.UserHandlerFunc(AuthenticatedHandlerWithUser)))
+
+	http.ListenAndServe(":5100", nil)
+}
+
+func ExampleValidator() {
+	getProviders := func() ([]openid.Provider, error) {
+		provider, err := openid.NewProvider("https://accounts.google.com", []string{"407408718192.apps.googleusercontent.com"})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []openid.Provider{provider}, nil
+	}
+
+	configuration, err := openid.NewConfiguration(openid.ProvidersGetter(getProviders))
+
+	if err != nil {
+		panic(err)
+	}
+
+	validator := openid.NewValidator(configuration)
+
+	// The raw token received, for instance, in the metadata of a gRPC call or with a queue message.
+	rawToken := "eyJhbGciOiJSUzI1NiIsImtpZCI6..."
+
+	user, err := validator.Validate(context.Background(), rawToken)
+
+	if err != nil {
+		fmt.Println("The token is not valid:", err)
+		return
+	}
+
+	fmt.Printf("Authenticated! The user is %+v.", user)
+}
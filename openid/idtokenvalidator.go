@@ -1,11 +1,14 @@
 package openid
 
 import (
+	"crypto/ecdsa"
 	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"net/http"
-
-	"github.com/dgrijalva/jwt-go"
+	"time"
 )
 
 const issuerClaimName = "iss"
@@ -14,70 +17,127 @@ const subjectClaimName = "sub"
 const keyIDJwtHeaderName = "kid"
 
 type jwtTokenValidator interface {
-	validate(r *http.Request, t string) (jt *jwt.Token, err error)
+	validate(r *http.Request, t string) (jt *jwtToken, err error)
 }
 
 type jwtParser interface {
-	parse(string, jwt.Keyfunc) (*jwt.Token, error)
+	parse(string, jwtKeyFunc) (*jwtToken, error)
 }
 
-type jwtParserFunc func(string, jwt.Keyfunc) (*jwt.Token, error)
+type jwtParserFunc func(string, jwtKeyFunc) (*jwtToken, error)
 
-func (p jwtParserFunc) parse(token string, keyFunc jwt.Keyfunc) (*jwt.Token, error) {
+func (p jwtParserFunc) parse(token string, keyFunc jwtKeyFunc) (*jwtToken, error) {
 	return p(token, keyFunc)
 }
 
-type pemToRSAPublicKeyParser interface {
-	parse(key []byte) (*rsa.PublicKey, error)
+type pemToPublicKeyParser interface {
+	parse(key []byte) (interface{}, error)
 }
 
-type defaultPemToRSAPublicKeyParser struct {
+type defaultPemToPublicKeyParser struct {
 }
 
-func (p *defaultPemToRSAPublicKeyParser) parse(key []byte) (*rsa.PublicKey, error) {
-	return jwt.ParseRSAPublicKeyFromPEM(key)
+// parse returns the RSA or ECDSA public key, the ones verifying the algorithms accepted by parseJWT,
+// encoded in the PEM block.
+func (p *defaultPemToPublicKeyParser) parse(key []byte) (interface{}, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, errors.New("the key must be PEM encoded")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		cert, cerr := x509.ParseCertificate(block.Bytes)
+		if cerr != nil {
+			return nil, err
+		}
+
+		pub = cert.PublicKey
+	}
+
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return pub, nil
+	}
+
+	return nil, fmt.Errorf("the key of type %T is not a RSA or ECDSA public key", pub)
 }
 
-// type pemToRSAPublicKeyParserFunc func(key []byte) (*rsa.PublicKey, error)
+// type pemToPublicKeyParserFunc func(key []byte) (interface{}, error)
 
 type idTokenValidator struct {
-	provGetter providersGetter
-	jwtParser  jwtParser
-	keyGetter  signingKeyGetter
-	rsaParser  pemToRSAPublicKeyParser
+	provGetter       providersGetter
+	jwtParser        jwtParser
+	keyGetter        signingKeyGetter
+	keyParser        pemToPublicKeyParser
+	now              func() time.Time
+	leeway           time.Duration
+	tokenAge         *TokenAgePolicy
+	strict           bool
+	nonceVerifier    NonceVerifier
+	claimsValidators []ClaimsValidator
+	accessTokens     bool
+	revocationStore  RevocationStore
 }
 
-func newIDTokenValidator(pg GetProvidersFunc, jp jwtParser, kg signingKeyGetter, kp pemToRSAPublicKeyParser) *idTokenValidator {
-	return &idTokenValidator{pg, jp, kg, kp}
+func newIDTokenValidator(pg GetProvidersFunc, jp jwtParser, kg signingKeyGetter, kp pemToPublicKeyParser) *idTokenValidator {
+	return &idTokenValidator{provGetter: pg, jwtParser: jp, keyGetter: kg, keyParser: kp, now: time.Now}
 }
 
-func (tv *idTokenValidator) validate(r *http.Request, t string) (*jwt.Token, error) {
-	jt, err := tv.jwtParser.parse(t, func(tok *jwt.Token) (interface{}, error) {
-		return tv.getSigningKey(r, tok)
+func (tv *idTokenValidator) validate(r *http.Request, t string) (*jwtToken, error) {
+	var p *Provider
+	jt, err := tv.jwtParser.parse(t, func(tok *jwtToken) (interface{}, error) {
+		var key interface{}
+		var err error
+		p, key, err = tv.getSigningKey(r, tok)
+		return key, err
 	})
-	if err != nil {
-
-		if verr, ok := err.(*jwt.ValidationError); ok {
-			// If the signing key did not match it may be because the in memory key is outdated.
-			// Renew the cached signing key.
-			if (verr.Errors & jwt.ValidationErrorSignatureInvalid) != 0 {
-				jt, err = tv.jwtParser.parse(t, func(tok *jwt.Token) (interface{}, error) {
-					return tv.renewAndGetSigningKey(r, tok)
-				})
-			}
-		}
+	if jerr, ok := err.(*jwtError); ok && jerr.Kind == jwtErrorSignatureInvalid {
+		// If the signing key did not match it may be because the in memory key is outdated.
+		// Renew the cached signing key.
+		jt, err = tv.jwtParser.parse(t, func(tok *jwtToken) (interface{}, error) {
+			return tv.renewAndGetSigningKey(r, tok)
+		})
 	}
 
 	if err != nil {
 		return nil, jwtErrorToOpenIDError(err)
 	}
 
+	if err = tv.validateTokenType(jt); err != nil {
+		return nil, err
+	}
+
+	if err = tv.validateStrict(jt, p); err != nil {
+		return nil, err
+	}
+
+	if err = tv.validateTimeClaims(jt, p); err != nil {
+		return nil, err
+	}
+
+	if err = tv.validateTokenAge(jt, p); err != nil {
+		return nil, err
+	}
+
+	if err = tv.validateNonce(r, jt); err != nil {
+		return nil, err
+	}
+
+	if err = tv.validateClaims(r, jt, p); err != nil {
+		return nil, err
+	}
+
+	if err = tv.validateRevocation(r, jt); err != nil {
+		return nil, err
+	}
+
 	return jt, nil
 }
 
-func (tv *idTokenValidator) renewAndGetSigningKey(r *http.Request, jt *jwt.Token) (interface{}, error) {
+func (tv *idTokenValidator) renewAndGetSigningKey(r *http.Request, jt *jwtToken) (interface{}, error) {
 	// Issuer is already validated when 'getSigningKey was called.
-	iss := jt.Claims.(jwt.MapClaims)[issuerClaimName].(string)
+	iss := jt.Claims[issuerClaimName].(string)
 
 	err := tv.keyGetter.flushCachedSigningKeys(iss)
 	if err != nil {
@@ -88,52 +148,63 @@ func (tv *idTokenValidator) renewAndGetSigningKey(r *http.Request, jt *jwt.Token
 
 	var key []byte
 	if key, err = tv.keyGetter.getSigningKey(r, iss, kid); err == nil {
-		return tv.rsaParser.parse(key)
+		return tv.keyParser.parse(key)
 	}
 
 	return nil, err
 }
 
-func (tv *idTokenValidator) getSigningKey(r *http.Request, jt *jwt.Token) (interface{}, error) {
+// getSigningKey validates the token issuer, audiences and subject and returns the
+// matching provider along with the key to be used to verify the token signature.
+func (tv *idTokenValidator) getSigningKey(r *http.Request, jt *jwtToken) (*Provider, interface{}, error) {
 	provs, err := tv.provGetter.get()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if err := providers(provs).validate(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	p, err := validateIssuer(jt, provs)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	_, err = validateAudiences(jt, p)
+	if tv.accessTokens {
+		_, err = validateResourceAudiences(jt, p)
+	} else {
+		_, err = validateAudiences(jt, p)
+	}
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	_, err = validateSubject(jt)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	kid := getTokenKid(jt)
 
 	var key []byte
-	if key, err = tv.keyGetter.getSigningKey(r, p.Issuer, kid); err == nil {
-		return tv.rsaParser.parse(key)
+	if key, err = tv.keyGetter.getSigningKey(r, p.Issuer, kid); err != nil {
+		return nil, nil, err
 	}
 
-	return nil, err
+	pk, err := tv.keyParser.parse(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return p, pk, nil
 }
 
-func getTokenKid(jt *jwt.Token) string {
+func getTokenKid(jt *jwtToken) string {
 	kid, _ := jt.Header[keyIDJwtHeaderName].(string)
 	return kid
 }
 
-func validateIssuer(jt *jwt.Token, ps []Provider) (*Provider, error) {
+func validateIssuer(jt *jwtToken, ps []Provider) (*Provider, error) {
 	issuerClaim := getIssuer(jt)
 	var ti string
 
@@ -155,16 +226,8 @@ func validateIssuer(jt *jwt.Token, ps []Provider) (*Provider, error) {
 		}
 	}
 
-	// Workaround for tokens issued by google
-	gi := ti
-	if gi == "accounts.google.com" {
-		gi = "https://" + gi
-	}
-
-	for _, p := range ps {
-		if ti == p.Issuer || gi == p.Issuer {
-			return &p, nil
-		}
+	if p := providers(ps).find(ti); p != nil {
+		return p, nil
 	}
 
 	return nil, &ValidationError{
@@ -174,7 +237,7 @@ func validateIssuer(jt *jwt.Token, ps []Provider) (*Provider, error) {
 	}
 }
 
-func validateSubject(jt *jwt.Token) (string, error) {
+func validateSubject(jt *jwtToken) (string, error) {
 	subjectClaim := getSubject(jt)
 
 	var ts string
@@ -199,14 +262,20 @@ func validateSubject(jt *jwt.Token) (string, error) {
 	return ts, nil
 }
 
-func validateAudiences(jt *jwt.Token, p *Provider) (string, error) {
+func validateAudiences(jt *jwtToken, p *Provider) (string, error) {
+	return matchAudiences(jt, p, p.ClientIDs, "client id")
+}
+
+// matchAudiences returns the first of the allowed audiences found in the token 'aud' claim.
+// The kind describes the allowed audiences in the error message.
+func matchAudiences(jt *jwtToken, p *Provider, allowed []string, kind string) (string, error) {
 	audiencesClaim, err := getAudiences(jt)
 
 	if err != nil {
 		return "", err
 	}
 
-	for _, aud := range p.ClientIDs {
+	for _, aud := range allowed {
 		for _, audienceClaim := range audiencesClaim {
 			ta, ok := audienceClaim.(string)
 			if !ok {
@@ -234,13 +303,13 @@ func validateAudiences(jt *jwt.Token, p *Provider) (string, error) {
 
 	return "", &ValidationError{
 		Code:       ValidationErrorAudienceNotFound,
-		Message:    fmt.Sprintf("The provider %v does not have a client id matching any of the token audiences %+v", p.Issuer, audiencesClaim),
+		Message:    fmt.Sprintf("The provider %v does not have a %v matching any of the token audiences %+v", p.Issuer, kind, audiencesClaim),
 		HTTPStatus: http.StatusUnauthorized,
 	}
 }
 
-func getAudiences(t *jwt.Token) ([]interface{}, error) {
-	audiencesClaim := t.Claims.(jwt.MapClaims)[audiencesClaimName]
+func getAudiences(t *jwtToken) ([]interface{}, error) {
+	audiencesClaim := t.Claims[audiencesClaimName]
 	if aud, ok := audiencesClaim.(string); ok {
 		return []interface{}{aud}, nil
 	} else if _, ok := audiencesClaim.([]interface{}); ok {
@@ -255,10 +324,10 @@ func getAudiences(t *jwt.Token) ([]interface{}, error) {
 
 }
 
-func getIssuer(t *jwt.Token) interface{} {
-	return t.Claims.(jwt.MapClaims)[issuerClaimName]
+func getIssuer(t *jwtToken) interface{} {
+	return t.Claims[issuerClaimName]
 }
 
-func getSubject(t *jwt.Token) interface{} {
-	return t.Claims.(jwt.MapClaims)[subjectClaimName]
+func getSubject(t *jwtToken) interface{} {
+	return t.Claims[subjectClaimName]
 }
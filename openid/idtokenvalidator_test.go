@@ -6,8 +6,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -17,7 +17,7 @@ func Test_getSigningKey_WhenGetProvidersReturnsError(t *testing.T) {
 	ee := errors.New("Error getting providers")
 	pm.On("get").Return(nil, ee)
 
-	sk, err := tv.getSigningKey(nil, nil)
+	_, sk, err := tv.getSigningKey(nil, nil)
 
 	if sk != nil {
 		t.Error("The returned signing key should be nil.")
@@ -41,10 +41,10 @@ func Test_getSigningKey_WhenGetProvidersReturnsEmptyCollection(t *testing.T) {
 
 	pm.On("get").Return([]Provider{}, nil).Once()
 
-	_, err := tv.getSigningKey(nil, nil)
+	_, _, err := tv.getSigningKey(nil, nil)
 	expectSetupError(t, err, SetupErrorEmptyProviderCollection)
 
-	_, err = tv.getSigningKey(nil, nil)
+	_, _, err = tv.getSigningKey(nil, nil)
 	expectSetupError(t, err, SetupErrorEmptyProviderCollection)
 
 	pm.AssertExpectations(t)
@@ -54,9 +54,9 @@ func Test_getSigningKey_UsingTokenWithInvalidIssuerType(t *testing.T) {
 	pm, _, _, _, tv := createIDTokenValidator(t)
 	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}}}, nil)
 
-	jt := jwt.New(jwt.SigningMethodRS256)
-	jt.Claims.(jwt.MapClaims)["iss"] = 0 // The expected issuer type is string, not int.
-	sk, err := tv.getSigningKey(nil, jt)
+	jt := createTokenWithClaims(jwtClaims{})
+	jt.Claims["iss"] = 0 // The expected issuer type is string, not int.
+	_, sk, err := tv.getSigningKey(nil, jt)
 
 	if sk != nil {
 		t.Error("The returned signing key should be nil.")
@@ -72,10 +72,10 @@ func Test_getSigningKey_UsingTokenWithEmptyIssuer(t *testing.T) {
 	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}}}, nil).Once()
 	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}}}, nil).Once()
 
-	jt := jwt.New(jwt.SigningMethodRS256)
+	jt := createTokenWithClaims(jwtClaims{})
 
 	// The token has no 'iss' claim
-	sk, err := tv.getSigningKey(nil, jt)
+	_, sk, err := tv.getSigningKey(nil, jt)
 
 	if sk != nil {
 		t.Error("The returned signing key should be nil.")
@@ -84,8 +84,8 @@ func Test_getSigningKey_UsingTokenWithEmptyIssuer(t *testing.T) {
 	expectValidationError(t, err, ValidationErrorInvalidIssuerType, http.StatusUnauthorized, nil)
 
 	// The token has '' as 'iss' claim
-	jt.Claims.(jwt.MapClaims)["iss"] = ""
-	sk, err = tv.getSigningKey(nil, jt)
+	jt.Claims["iss"] = ""
+	_, sk, err = tv.getSigningKey(nil, jt)
 
 	if sk != nil {
 		t.Error("The returned signing key should be nil.")
@@ -101,11 +101,11 @@ func Test_getSigningKey_UsingTokenWithUnknownIssuer(t *testing.T) {
 
 	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}}}, nil)
 
-	jt := jwt.New(jwt.SigningMethodRS256)
-	jt.Claims.(jwt.MapClaims)["iss"] = "http://unknown"
+	jt := createTokenWithClaims(jwtClaims{})
+	jt.Claims["iss"] = "http://unknown"
 
 	// The token has no 'iss' claim
-	sk, err := tv.getSigningKey(nil, jt)
+	_, sk, err := tv.getSigningKey(nil, jt)
 
 	if sk != nil {
 		t.Error("The returned signing key should be nil.")
@@ -120,11 +120,11 @@ func Test_getSigningKey_UsingTokenWithInvalidAudienceType(t *testing.T) {
 
 	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}}}, nil)
 
-	jt := jwt.New(jwt.SigningMethodRS256)
-	jt.Claims.(jwt.MapClaims)["iss"] = "https://issuer"
-	jt.Claims.(jwt.MapClaims)["aud"] = 0 // Expected 'aud' type is string
+	jt := createTokenWithClaims(jwtClaims{})
+	jt.Claims["iss"] = "https://issuer"
+	jt.Claims["aud"] = 0 // Expected 'aud' type is string
 
-	sk, err := tv.getSigningKey(nil, jt)
+	_, sk, err := tv.getSigningKey(nil, jt)
 
 	if sk != nil {
 		t.Error("The returned signing key should be nil.")
@@ -140,11 +140,11 @@ func Test_getSigningKey_UsingTokenWithInvalidAudience(t *testing.T) {
 	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}}}, nil).Once()
 	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}}}, nil).Once()
 
-	jt := jwt.New(jwt.SigningMethodRS256)
-	jt.Claims.(jwt.MapClaims)["iss"] = "https://issuer"
+	jt := createTokenWithClaims(jwtClaims{})
+	jt.Claims["iss"] = "https://issuer"
 
 	// No audience claim
-	sk, err := tv.getSigningKey(nil, jt)
+	_, sk, err := tv.getSigningKey(nil, jt)
 
 	if sk != nil {
 		t.Error("The returned signing key should be nil.")
@@ -153,8 +153,8 @@ func Test_getSigningKey_UsingTokenWithInvalidAudience(t *testing.T) {
 	expectValidationError(t, err, ValidationErrorInvalidAudienceType, http.StatusUnauthorized, nil)
 
 	// Empty audience claim.
-	jt.Claims.(jwt.MapClaims)["aud"] = ""
-	sk, err = tv.getSigningKey(nil, jt)
+	jt.Claims["aud"] = ""
+	_, sk, err = tv.getSigningKey(nil, jt)
 
 	if sk != nil {
 		t.Error("The returned signing key should be nil.")
@@ -169,11 +169,11 @@ func Test_getSigningKey_UsingTokenWithUnknownAudience(t *testing.T) {
 
 	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client1", "client2"}}}, nil)
 
-	jt := jwt.New(jwt.SigningMethodRS256)
-	jt.Claims.(jwt.MapClaims)["iss"] = "https://issuer"
-	jt.Claims.(jwt.MapClaims)["aud"] = "client3" // unknown audience
+	jt := createTokenWithClaims(jwtClaims{})
+	jt.Claims["iss"] = "https://issuer"
+	jt.Claims["aud"] = "client3" // unknown audience
 
-	sk, err := tv.getSigningKey(nil, jt)
+	_, sk, err := tv.getSigningKey(nil, jt)
 
 	if sk != nil {
 		t.Error("The returned signing key should be nil.")
@@ -188,11 +188,11 @@ func Test_getSigningKey_UsingTokenWithUnknownMultipleAudiences(t *testing.T) {
 
 	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client1", "client2"}}}, nil)
 
-	jt := jwt.New(jwt.SigningMethodRS256)
-	jt.Claims.(jwt.MapClaims)["iss"] = "https://issuer"
-	jt.Claims.(jwt.MapClaims)["aud"] = []interface{}{"client3", "client4"} // unknown audiences
+	jt := createTokenWithClaims(jwtClaims{})
+	jt.Claims["iss"] = "https://issuer"
+	jt.Claims["aud"] = []interface{}{"client3", "client4"} // unknown audiences
 
-	sk, err := tv.getSigningKey(nil, jt)
+	_, sk, err := tv.getSigningKey(nil, jt)
 
 	if sk != nil {
 		t.Error("The returned signing key should be nil.")
@@ -207,11 +207,11 @@ func Test_getSigningKey_UsingTokenWithInvalidSubjectType(t *testing.T) {
 
 	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}}}, nil)
 
-	jt := jwt.New(jwt.SigningMethodRS256)
-	jt.Claims.(jwt.MapClaims)["iss"] = "https://issuer"
-	jt.Claims.(jwt.MapClaims)["aud"] = "client"
-	jt.Claims.(jwt.MapClaims)["sub"] = 0 // The expected 'sub' claim type is string
-	sk, err := tv.getSigningKey(nil, jt)
+	jt := createTokenWithClaims(jwtClaims{})
+	jt.Claims["iss"] = "https://issuer"
+	jt.Claims["aud"] = "client"
+	jt.Claims["sub"] = 0 // The expected 'sub' claim type is string
+	_, sk, err := tv.getSigningKey(nil, jt)
 
 	if sk != nil {
 		t.Error("The returned signing key should be nil.")
@@ -232,13 +232,13 @@ func Test_getSigningKey_UsingValidToken_WhenSigningKeyGetterReturnsError(t *test
 	sm.On("getSigningKey", req, iss, keyID).Return(nil, ee)
 	pm.On("get").Return([]Provider{{Issuer: iss, ClientIDs: []string{"client"}}}, nil)
 
-	jt := jwt.New(jwt.SigningMethodRS256)
-	jt.Claims.(jwt.MapClaims)["iss"] = iss
-	jt.Claims.(jwt.MapClaims)["aud"] = "client"
-	jt.Claims.(jwt.MapClaims)["sub"] = "subject1"
+	jt := createTokenWithClaims(jwtClaims{})
+	jt.Claims["iss"] = iss
+	jt.Claims["aud"] = "client"
+	jt.Claims["sub"] = "subject1"
 	jt.Header["kid"] = keyID
 
-	_, err := tv.getSigningKey(req, jt)
+	_, _, err := tv.getSigningKey(req, jt)
 
 	expectValidationError(t, err, ee.Code, ee.HTTPStatus, nil)
 	pm.AssertExpectations(t)
@@ -258,13 +258,13 @@ func Test_getSigningKey_UsingValidToken_WhenSigningKeyGetterSucceeds(t *testing.
 	pm.On("get").Return([]Provider{{Issuer: iss, ClientIDs: []string{"client"}}}, nil)
 	kp.On("parse", []byte(esk)).Return(pk, nil)
 
-	jt := jwt.New(jwt.SigningMethodRS256)
-	jt.Claims.(jwt.MapClaims)["iss"] = iss
-	jt.Claims.(jwt.MapClaims)["aud"] = "client"
-	jt.Claims.(jwt.MapClaims)["sub"] = "subject1"
+	jt := createTokenWithClaims(jwtClaims{})
+	jt.Claims["iss"] = iss
+	jt.Claims["aud"] = "client"
+	jt.Claims["sub"] = "subject1"
 	jt.Header["kid"] = keyID
 
-	rsk, err := tv.getSigningKey(req, jt)
+	_, rsk, err := tv.getSigningKey(req, jt)
 
 	if err != nil {
 		t.Error("An error was returned but not expected.", err)
@@ -288,12 +288,12 @@ func Test_getSigningKey_UsingValidToken_WithoutKeyIdentifier_WhenSigningKeyGette
 	pm.On("get").Return([]Provider{{Issuer: iss, ClientIDs: []string{"client"}}}, nil)
 	kp.On("parse", []byte(esk)).Return(pk, nil)
 
-	jt := jwt.New(jwt.SigningMethodRS256)
-	jt.Claims.(jwt.MapClaims)["iss"] = iss
-	jt.Claims.(jwt.MapClaims)["aud"] = "client"
-	jt.Claims.(jwt.MapClaims)["sub"] = "subject1"
+	jt := createTokenWithClaims(jwtClaims{})
+	jt.Claims["iss"] = iss
+	jt.Claims["aud"] = "client"
+	jt.Claims["sub"] = "subject1"
 
-	rsk, err := tv.getSigningKey(nil, jt)
+	_, rsk, err := tv.getSigningKey(nil, jt)
 
 	if err != nil {
 		t.Error("An error was returned but not expected.", err)
@@ -319,13 +319,13 @@ func Test_getSigningKey_UsingValidTokenWithMultipleAudiences(t *testing.T) {
 	pm.On("get").Return([]Provider{{Issuer: iss, ClientIDs: []string{"client"}}}, nil)
 	kp.On("parse", []byte(esk)).Return(pk, nil)
 
-	jt := jwt.New(jwt.SigningMethodRS256)
-	jt.Claims.(jwt.MapClaims)["iss"] = iss
-	jt.Claims.(jwt.MapClaims)["aud"] = []interface{}{"unknown", "client"}
-	jt.Claims.(jwt.MapClaims)["sub"] = "subject1"
+	jt := createTokenWithClaims(jwtClaims{})
+	jt.Claims["iss"] = iss
+	jt.Claims["aud"] = []interface{}{"unknown", "client"}
+	jt.Claims["sub"] = "subject1"
 	jt.Header["kid"] = keyID
 
-	rsk, err := tv.getSigningKey(nil, jt)
+	_, rsk, err := tv.getSigningKey(nil, jt)
 
 	if err != nil {
 		t.Error("An error was returned but not expected.", err)
@@ -344,8 +344,8 @@ func Test_renewAndGetSigningKey_UsingValidToken_WhenFlushCachedSigningKeysReturn
 	ee := &ValidationError{Code: ValidationErrorIssuerNotFound, HTTPStatus: http.StatusUnauthorized}
 	sm.On("flushCachedSigningKeys", mock.Anything).Return(ee)
 
-	jt := jwt.New(jwt.SigningMethodRS256)
-	jt.Claims.(jwt.MapClaims)["iss"] = ""
+	jt := createTokenWithClaims(jwtClaims{})
+	jt.Claims["iss"] = ""
 
 	_, err := tv.renewAndGetSigningKey(nil, jt)
 
@@ -361,8 +361,8 @@ func Test_renewAndGetSigningKey_UsingValidToken_WhenGetSigningKeyReturnsError(t
 	sm.On("getSigningKey", (*http.Request)(nil), mock.Anything, mock.Anything).Return(nil, ee)
 	sm.On("flushCachedSigningKeys", mock.Anything).Return(nil)
 
-	jt := jwt.New(jwt.SigningMethodRS256)
-	jt.Claims.(jwt.MapClaims)["iss"] = ""
+	jt := createTokenWithClaims(jwtClaims{})
+	jt.Claims["iss"] = ""
 	jt.Header["kid"] = ""
 
 	_, err := tv.renewAndGetSigningKey(nil, jt)
@@ -381,8 +381,8 @@ func Test_renewAndGetSigningKey_UsingValidToken_WhenGetSigningKeySucceeds(t *tes
 	sm.On("flushCachedSigningKeys", mock.Anything).Return(nil)
 	kp.On("parse", []byte(esk)).Return(pk, nil)
 
-	jt := jwt.New(jwt.SigningMethodRS256)
-	jt.Claims.(jwt.MapClaims)["iss"] = ""
+	jt := createTokenWithClaims(jwtClaims{})
+	jt.Claims["iss"] = ""
 	jt.Header["kid"] = ""
 
 	rsk, err := tv.renewAndGetSigningKey(nil, jt)
@@ -399,10 +399,10 @@ func Test_renewAndGetSigningKey_UsingValidToken_WhenGetSigningKeySucceeds(t *tes
 func Test_validate_WhenParserReturnsErrorFirstTime(t *testing.T) {
 	_, jm, _, _, tv := createIDTokenValidator(t)
 
-	je := &jwt.ValidationError{Errors: jwt.ValidationErrorNotValidYet}
+	je := &jwtError{Kind: jwtErrorUnverifiable, Err: errors.New("key not found")}
 	ee := &ValidationError{Code: ValidationErrorJwtValidationFailure, HTTPStatus: http.StatusUnauthorized}
 
-	jm.On("parse", mock.Anything, mock.AnythingOfType("jwt.Keyfunc")).Return(nil, je)
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(nil, je)
 
 	_, err := tv.validate(nil, mock.Anything)
 
@@ -414,9 +414,9 @@ func Test_validate_WhenParserReturnsErrorFirstTime(t *testing.T) {
 func Test_validate_WhenParserSuceedsFirstTime(t *testing.T) {
 	_, jm, _, _, tv := createIDTokenValidator(t)
 
-	jt := &jwt.Token{}
+	jt := &jwtToken{}
 
-	jm.On("parse", mock.Anything, mock.AnythingOfType("jwt.Keyfunc")).Return(jt, nil)
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(jt, nil)
 
 	rjt, err := tv.validate(nil, mock.Anything)
 
@@ -434,12 +434,12 @@ func Test_validate_WhenParserSuceedsFirstTime(t *testing.T) {
 func Test_validate_WhenParserReturnsErrorSecondTime(t *testing.T) {
 	_, jm, _, _, tv := createIDTokenValidator(t)
 
-	jfe := &jwt.ValidationError{Errors: jwt.ValidationErrorSignatureInvalid}
-	je := &jwt.ValidationError{Errors: jwt.ValidationErrorMalformed}
+	jfe := &jwtError{Kind: jwtErrorSignatureInvalid}
+	je := &jwtError{Kind: jwtErrorMalformed}
 	ee := &ValidationError{Code: ValidationErrorJwtValidationFailure, HTTPStatus: http.StatusBadRequest}
 
-	jm.On("parse", mock.Anything, mock.AnythingOfType("jwt.Keyfunc")).Return(nil, jfe).Once()
-	jm.On("parse", mock.Anything, mock.AnythingOfType("jwt.Keyfunc")).Return(nil, je).Once()
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(nil, jfe).Once()
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(nil, je).Once()
 
 	_, err := tv.validate(nil, mock.Anything)
 
@@ -451,11 +451,11 @@ func Test_validate_WhenParserReturnsErrorSecondTime(t *testing.T) {
 func Test_validate_WhenParserReturnsSignatureInvalidErrorSecondTime(t *testing.T) {
 	_, jm, _, _, tv := createIDTokenValidator(t)
 
-	je := &jwt.ValidationError{Errors: jwt.ValidationErrorSignatureInvalid}
+	je := &jwtError{Kind: jwtErrorSignatureInvalid}
 	ee := &ValidationError{Code: ValidationErrorJwtValidationFailure, HTTPStatus: http.StatusUnauthorized}
 
-	jm.On("parse", mock.Anything, mock.AnythingOfType("jwt.Keyfunc")).Return(nil, je).Once()
-	jm.On("parse", mock.Anything, mock.AnythingOfType("jwt.Keyfunc")).Return(nil, je).Once()
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(nil, je).Once()
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(nil, je).Once()
 
 	_, err := tv.validate(nil, mock.Anything)
 
@@ -467,12 +467,12 @@ func Test_validate_WhenParserReturnsSignatureInvalidErrorSecondTime(t *testing.T
 func Test_validate_WhenParserSuceedsSecondTime(t *testing.T) {
 	_, jm, _, _, tv := createIDTokenValidator(t)
 
-	jfe := &jwt.ValidationError{Errors: jwt.ValidationErrorSignatureInvalid}
+	jfe := &jwtError{Kind: jwtErrorSignatureInvalid}
 
-	jt := &jwt.Token{}
+	jt := &jwtToken{}
 
-	jm.On("parse", mock.Anything, mock.AnythingOfType("jwt.Keyfunc")).Return(jt, jfe).Once()
-	jm.On("parse", mock.Anything, mock.AnythingOfType("jwt.Keyfunc")).Return(jt, nil).Once()
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(jt, jfe).Once()
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(jt, nil).Once()
 
 	rjt, err := tv.validate(nil, mock.Anything)
 	if err != nil {
@@ -486,7 +486,7 @@ func Test_validate_WhenParserSuceedsSecondTime(t *testing.T) {
 	jm.AssertExpectations(t)
 }
 
-func expectSigningKey(t *testing.T, rsk interface{}, jt *jwt.Token, esk *rsa.PublicKey) {
+func expectSigningKey(t *testing.T, rsk interface{}, jt *jwtToken, esk *rsa.PublicKey) {
 
 	if rsk == nil {
 		t.Fatal("The returned signing key was nil.")
@@ -501,10 +501,10 @@ func expectSigningKey(t *testing.T, rsk interface{}, jt *jwt.Token, esk *rsa.Pub
 	}
 }
 
-func createIDTokenValidator(t *testing.T) (*mockProvidersGetter, *mockJwtParser, *mockSigningKeyGetter, *mockPemToRSAPublicKeyParser, *idTokenValidator) {
+func createIDTokenValidator(t *testing.T) (*mockProvidersGetter, *mockJwtParser, *mockSigningKeyGetter, *mockPemToPublicKeyParser, *idTokenValidator) {
 	pm := &mockProvidersGetter{}
 	jm := &mockJwtParser{}
 	sm := &mockSigningKeyGetter{}
-	kp := &mockPemToRSAPublicKeyParser{}
-	return pm, jm, sm, kp, &idTokenValidator{pm, jm, sm, kp}
+	kp := &mockPemToPublicKeyParser{}
+	return pm, jm, sm, kp, &idTokenValidator{provGetter: pm, jwtParser: jm, keyGetter: sm, keyParser: kp, now: time.Now}
 }
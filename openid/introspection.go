@@ -0,0 +1,499 @@
+package openid
+
+import (
+	"container/heap"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const activeClaimName = "active"
+const defaultInactiveTTL = 10 * time.Second
+const defaultIntrospectionMaxEntries = 10000
+
+// IntrospectionPolicy determines how the opaque tokens are validated with the OAuth 2.0 Token
+// Introspection (RFC 7662) endpoints of the OPs.
+//
+// The MaxTTL, when greater than zero, is the maximum time an introspection response is cached.
+// The responses for active tokens are cached until the token expires or the MaxTTL elapses,
+// whichever comes first. When zero the responses are cached until the tokens expire.
+//
+// The InactiveTTL is the time the tokens reported as inactive are remembered, so that they are
+// rejected without being introspected again. When zero it defaults to 10 seconds.
+//
+// The MaxEntries is the maximum number of responses cached, the ones expiring first being evicted
+// when it is reached. When zero it defaults to 10000.
+//
+// The IssuerHint, when not nil, returns the issuer of the provider the token is introspected with,
+// for instance from a request header or from a prefix of the token. The token is then only sent to
+// that provider. When it is nil or returns an empty string the token is sent to the providers
+// having an IntrospectionClientID in order, stopping at the first one reporting it as active or
+// failing, which discloses it to the providers before that one. The IssuerHint should be used
+// when more than one provider can introspect tokens.
+//
+// The Client is the client used to call the introspection endpoints. When nil http.DefaultClient
+// is used.
+type IntrospectionPolicy struct {
+	MaxTTL      time.Duration
+	InactiveTTL time.Duration
+	MaxEntries  int
+	IssuerHint  func(r *http.Request, token string) string
+	Client      *http.Client
+}
+
+// TokenIntrospection option enables the validation of opaque tokens through the OAuth 2.0 Token
+// Introspection endpoints of the OPs. The tokens shaped as JWTs are still validated locally while
+// the other ones are sent to the introspection_endpoint published, in their OIDC metadata, by the
+// providers having an IntrospectionClientID, which is used with the IntrospectionClientSecret to
+// authenticate the calls. The metadata is cached and retrieved again when the endpoint fails.
+// The token is valid when the provider it is sent to reports it as active, its claims are then
+// validated like the ones of the JWTs, i.e.: time based claims, token age, audiences, claims
+// validators and revocation. The token type is not validated since opaque tokens have no header.
+// When the response does not contain the 'aud' claim its 'client_id' must be one of the ClientIDs
+// of the provider. When the response does not contain the 'iss' claim the provider issuer is used
+// and when it does not contain the 'sub' claim its 'client_id' is used.
+// When this option is not used the opaque tokens are rejected as malformed JWTs.
+func TokenIntrospection(ip IntrospectionPolicy) func(*Configuration) error {
+	return func(c *Configuration) error {
+		if ip.MaxTTL < 0 || ip.InactiveTTL < 0 || ip.MaxEntries < 0 {
+			return &SetupError{
+				Code:    SetupErrorInvalidIntrospectionPolicy,
+				Message: "The introspection MaxTTL, InactiveTTL and MaxEntries must not be negative.",
+			}
+		}
+
+		c.introspectionPolicy = &ip
+		return nil
+	}
+}
+
+type introspectionTokenValidator struct {
+	next         jwtTokenValidator
+	tv           *idTokenValidator
+	configGetter configurationGetter
+	policy       IntrospectionPolicy
+
+	mu      sync.Mutex
+	cache   map[string]*introspectionCacheEntry
+	queue   replayQueue
+	configs map[string]configuration
+}
+
+// providerConfigurationGetter retrieves the configurations of the OPs like the signing keys are,
+// i.e.: from their MetadataEndpoints and through the circuit breaker when there is one.
+type providerConfigurationGetter struct {
+	ksp *signingKeySetProvider
+	cb  *circuitBreakerKeySetProvider
+}
+
+func (pg *providerConfigurationGetter) get(r *http.Request, iss string) (configuration, error) {
+	if pg.cb == nil {
+		return pg.ksp.getConfiguration(r, iss)
+	}
+
+	var conf configuration
+	err := pg.cb.guard(r, iss, func() error {
+		var err error
+		conf, err = pg.ksp.getConfiguration(r, iss)
+		return err
+	})
+
+	return conf, err
+}
+
+// introspectionCacheEntry is the cached introspection response, the claims being nil when the
+// token was reported as inactive.
+// The entries are queued by expiration like the tokens recorded by the MemoryReplayStore.
+type introspectionCacheEntry struct {
+	replayEntry
+	claims   jwtClaims
+	provider Provider
+}
+
+// newIntrospectionTokenValidator returns the validator introspecting the opaque tokens and
+// forwarding the JWTs to next. The tv validates the claims of the introspected tokens.
+func newIntrospectionTokenValidator(next jwtTokenValidator, tv *idTokenValidator, cg configurationGetter, ip IntrospectionPolicy) *introspectionTokenValidator {
+	return &introspectionTokenValidator{
+		next:         next,
+		tv:           tv,
+		configGetter: cg,
+		policy:       ip,
+		cache:        make(map[string]*introspectionCacheEntry),
+		configs:      make(map[string]configuration),
+	}
+}
+
+func (iv *introspectionTokenValidator) validate(r *http.Request, t string) (*jwtToken, error) {
+	if isJWTShaped(t) {
+		return iv.next.validate(r, t)
+	}
+
+	// The hint is part of the key so that a response is only reused for the provider it came from.
+	hint := iv.issuerHint(r, t)
+	sum := sha256.Sum256([]byte(hint + "\x00" + t))
+	key := string(sum[:])
+	claims, p, fromCache := iv.cached(key)
+
+	if fromCache && claims == nil {
+		return nil, tokenInactiveError()
+	}
+
+	if !fromCache {
+		var err error
+		if claims, p, err = iv.introspect(r, hint, t); err != nil {
+			if verr, ok := err.(*ValidationError); ok && verr.Code == ValidationErrorTokenInactive {
+				iv.storeInactive(key)
+			}
+
+			return nil, err
+		}
+	}
+
+	jt := &jwtToken{Raw: t, Header: map[string]interface{}{}, Claims: claims}
+
+	if err := iv.tv.validateTimeClaims(jt, p); err != nil {
+		return nil, err
+	}
+
+	if err := iv.tv.validateTokenAge(jt, p); err != nil {
+		return nil, err
+	}
+
+	if err := iv.validateAudiences(jt, p); err != nil {
+		return nil, err
+	}
+
+	if err := iv.tv.validateClaims(r, jt, p); err != nil {
+		return nil, err
+	}
+
+	if err := iv.tv.validateRevocation(r, jt); err != nil {
+		return nil, err
+	}
+
+	if !fromCache {
+		iv.store(key, claims, p)
+	}
+
+	return jt, nil
+}
+
+// validateAudiences validates the 'aud' claim like the one of the JWTs, against the Audiences of
+// the provider when it has some or when access tokens are validated and against its ClientIDs
+// otherwise. When the response does not contain the 'aud' claim its 'client_id' must be one of
+// the ClientIDs of the provider.
+func (iv *introspectionTokenValidator) validateAudiences(jt *jwtToken, p *Provider) error {
+	if _, ok := jt.Claims[audiencesClaimName]; ok {
+		var err error
+		if iv.tv.accessTokens || len(p.Audiences) > 0 {
+			_, err = validateResourceAudiences(jt, p)
+		} else {
+			_, err = validateAudiences(jt, p)
+		}
+
+		return err
+	}
+
+	cID := stringClaim(jt.Claims, clientIDClaimName)
+	for _, c := range p.ClientIDs {
+		if cID != "" && cID == c {
+			return nil
+		}
+	}
+
+	return &ValidationError{
+		Code:       ValidationErrorAudienceNotFound,
+		Message:    fmt.Sprintf("The introspected token does not have an 'aud' claim and the provider %v does not have a client id matching its 'client_id' %v", p.Issuer, cID),
+		HTTPStatus: http.StatusUnauthorized,
+	}
+}
+
+// isJWTShaped returns whether the token has the shape of a signed or encrypted JWT in compact
+// serialization, i.e.: three or five segments separated by dots.
+func isJWTShaped(t string) bool {
+	n := strings.Count(t, ".") + 1
+	return n == 3 || n == 5
+}
+
+// cached returns a copy of the claims cached for the token along with its provider and whether
+// a response was found. The claims are nil when the token was reported as inactive.
+func (iv *introspectionTokenValidator) cached(key string) (jwtClaims, *Provider, bool) {
+	iv.mu.Lock()
+	defer iv.mu.Unlock()
+
+	e, ok := iv.cache[key]
+	if !ok || !iv.tv.now().Before(e.expires) {
+		return nil, nil, false
+	}
+
+	if e.claims == nil {
+		return nil, nil, true
+	}
+
+	claims := make(jwtClaims, len(e.claims))
+	for k, v := range e.claims {
+		claims[k] = v
+	}
+
+	p := e.provider
+	return claims, &p, true
+}
+
+func (iv *introspectionTokenValidator) store(key string, claims jwtClaims, p *Provider) {
+	now := iv.tv.now()
+	var expires time.Time
+	if exp, ok, _ := getTimeClaim(claims, expirationClaimName); ok {
+		expires = exp
+	}
+
+	if iv.policy.MaxTTL > 0 && (expires.IsZero() || expires.After(now.Add(iv.policy.MaxTTL))) {
+		expires = now.Add(iv.policy.MaxTTL)
+	}
+
+	cc := make(jwtClaims, len(claims))
+	for k, v := range claims {
+		cc[k] = v
+	}
+
+	iv.put(key, &introspectionCacheEntry{replayEntry: replayEntry{expires: expires}, claims: cc, provider: *p})
+}
+
+func (iv *introspectionTokenValidator) storeInactive(key string) {
+	ttl := iv.policy.InactiveTTL
+	if ttl == 0 {
+		ttl = defaultInactiveTTL
+	}
+
+	iv.put(key, &introspectionCacheEntry{replayEntry: replayEntry{expires: iv.tv.now().Add(ttl)}})
+}
+
+func (iv *introspectionTokenValidator) put(key string, e *introspectionCacheEntry) {
+	now := iv.tv.now()
+	if !now.Before(e.expires) {
+		return
+	}
+
+	iv.mu.Lock()
+	defer iv.mu.Unlock()
+
+	if old, ok := iv.cache[key]; ok {
+		heap.Remove(&iv.queue, old.index)
+		delete(iv.cache, key)
+	}
+
+	for len(iv.queue) > 0 && iv.queue[0].expired(now) {
+		iv.evict()
+	}
+
+	// Unlike the tokens recorded by the MemoryReplayStore the responses may be evicted before they
+	// expire, the tokens are then introspected again.
+	max := iv.policy.MaxEntries
+	if max == 0 {
+		max = defaultIntrospectionMaxEntries
+	}
+
+	for len(iv.queue) >= max {
+		iv.evict()
+	}
+
+	e.key = key
+	heap.Push(&iv.queue, &e.replayEntry)
+	iv.cache[key] = e
+}
+
+func (iv *introspectionTokenValidator) evict() {
+	e := heap.Pop(&iv.queue).(*replayEntry)
+	delete(iv.cache, e.key)
+}
+
+// introspect sends the token to the introspection endpoint of the provider with the hinted issuer
+// or, when there is none, to the ones of the providers able to introspect tokens until one of them
+// reports it as active or fails.
+func (iv *introspectionTokenValidator) introspect(r *http.Request, hint, t string) (jwtClaims, *Provider, error) {
+	provs, err := iv.tv.provGetter.get()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := providers(provs).validate(); err != nil {
+		return nil, nil, err
+	}
+
+	var candidates []*Provider
+	if hint != "" {
+		p := providers(provs).find(hint)
+		if p == nil || p.IntrospectionClientID == "" {
+			return nil, nil, &ValidationError{
+				Code:       ValidationErrorIssuerNotFound,
+				Message:    fmt.Sprintf("No provider introspecting tokens was registered with issuer: %v", hint),
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+
+		candidates = []*Provider{p}
+	} else {
+		for i := range provs {
+			if provs[i].IntrospectionClientID != "" {
+				candidates = append(candidates, &provs[i])
+			}
+		}
+	}
+
+	for _, p := range candidates {
+		// The token is not sent to the other providers when one of them fails.
+		claims, err := iv.introspectWith(r, p, t)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if claims != nil {
+			return claims, p, nil
+		}
+	}
+
+	return nil, nil, tokenInactiveError()
+}
+
+func (iv *introspectionTokenValidator) issuerHint(r *http.Request, t string) string {
+	if iv.policy.IssuerHint == nil {
+		return ""
+	}
+
+	return iv.policy.IssuerHint(r, t)
+}
+
+func tokenInactiveError() error {
+	return &ValidationError{
+		Code:       ValidationErrorTokenInactive,
+		Message:    "The token is not active.",
+		HTTPStatus: http.StatusUnauthorized,
+	}
+}
+
+// configuration returns the configuration of the OP with the given issuer, retrieved once and then
+// cached like its signing keys. The configurations without introspection_endpoint are not cached.
+func (iv *introspectionTokenValidator) configuration(r *http.Request, iss string) (configuration, error) {
+	iv.mu.Lock()
+	config, ok := iv.configs[iss]
+	iv.mu.Unlock()
+
+	if ok {
+		return config, nil
+	}
+
+	config, err := iv.configGetter.get(r, iss)
+	if err != nil || config.IntrospectionEndpoint == "" {
+		return config, err
+	}
+
+	iv.mu.Lock()
+	iv.configs[iss] = config
+	iv.mu.Unlock()
+
+	return config, nil
+}
+
+func (iv *introspectionTokenValidator) flushConfiguration(iss string) {
+	iv.mu.Lock()
+	defer iv.mu.Unlock()
+
+	delete(iv.configs, iss)
+}
+
+// introspectWith returns the claims of the token if the provider reports it as active, nil otherwise.
+func (iv *introspectionTokenValidator) introspectWith(r *http.Request, p *Provider, t string) (jwtClaims, error) {
+	config, err := iv.configuration(r, p.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.IntrospectionEndpoint == "" {
+		return nil, &ValidationError{
+			Code:       ValidationErrorIntrospectionNotSupported,
+			Message:    fmt.Sprintf("The provider %v does not publish an introspection_endpoint.", p.Issuer),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	claims, err := iv.post(r, config.IntrospectionEndpoint, p, t)
+	if err != nil {
+		// The configuration is retrieved again next time in case the endpoint moved.
+		iv.flushConfiguration(p.Issuer)
+		return nil, &ValidationError{
+			Code:       ValidationErrorIntrospectionFailure,
+			Message:    fmt.Sprintf("Failure while introspecting the token with the endpoint %v.", config.IntrospectionEndpoint),
+			Err:        err,
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	if active, _ := claims[activeClaimName].(bool); !active {
+		return nil, nil
+	}
+
+	delete(claims, activeClaimName)
+	if iss, found := claims[issuerClaimName]; !found {
+		claims[issuerClaimName] = p.Issuer
+	} else if iss != p.Issuer {
+		return nil, &ValidationError{
+			Code:       ValidationErrorInvalidIssuer,
+			Message:    fmt.Sprintf("The introspected token was issued by %v instead of %v.", iss, p.Issuer),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	if stringClaim(claims, subjectClaimName) == "" {
+		claims[subjectClaimName] = stringClaim(claims, clientIDClaimName)
+	}
+
+	return claims, nil
+}
+
+func (iv *introspectionTokenValidator) post(r *http.Request, endpoint string, p *Provider, t string) (jwtClaims, error) {
+	form := url.Values{"token": {t}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	if r != nil {
+		req = req.WithContext(r.Context())
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// The client credentials are form encoded before being used, see RFC 6749 section 2.3.1.
+	req.SetBasicAuth(url.QueryEscape(p.IntrospectionClientID), url.QueryEscape(p.IntrospectionClientSecret))
+
+	c := iv.policy.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the introspection endpoint responded with the status %v", resp.Status)
+	}
+
+	var claims jwtClaims
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, err
+	}
+
+	if claims == nil {
+		return nil, fmt.Errorf("the introspection endpoint responded with an empty document")
+	}
+
+	return claims, nil
+}
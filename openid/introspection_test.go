@@ -0,0 +1,391 @@
+package openid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_isJWTShaped(t *testing.T) {
+	assert.True(t, isJWTShaped("a.b.c"))
+	assert.True(t, isJWTShaped("a.b.c.d.e"))
+	assert.False(t, isJWTShaped("2YotnFZFEjr1zCsicMWpAA"))
+	assert.False(t, isJWTShaped("a.b"))
+}
+
+func Test_introspectionTokenValidator_validate_WhenTokenIsJWT(t *testing.T) {
+	_, jm, _, _, tv := createIDTokenValidator(t)
+	iv := newIntrospectionTokenValidator(tv, tv, &mockConfigurationGetter{}, IntrospectionPolicy{})
+
+	jt := createTokenWithClaims(jwtClaims{})
+	jm.On("parse", "a.b.c", mock.AnythingOfType("openid.jwtKeyFunc")).Return(jt, nil)
+
+	rjt, err := iv.validate(nil, "a.b.c")
+
+	assert.Nil(t, err)
+	assert.Equal(t, jt, rjt)
+	jm.AssertExpectations(t)
+}
+
+func Test_introspectionTokenValidator_validate_WhenTokenIsActive(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		id, secret, _ := r.BasicAuth()
+		assert.Equal(t, "rs%3Aapi", id)
+		assert.Equal(t, "s3cr3t", secret)
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "opaque", r.PostFormValue("token"))
+
+		w.Write([]byte(`{"active": true, "client_id": "client", "scope": "read", "aud": "https://api", "exp": ` +
+			fmtUnix(testNow.Add(time.Hour)) + `}`))
+	}))
+	defer server.Close()
+
+	iv, pm, cg := createIntrospectionTokenValidator(t, IntrospectionPolicy{MaxTTL: time.Minute})
+	pm.On("get").Return([]Provider{
+		{Issuer: "https://other", ClientIDs: []string{"client"}},
+		{Issuer: "https://issuer", Audiences: []string{"https://api"}, IntrospectionClientID: "rs:api", IntrospectionClientSecret: "s3cr3t"},
+	}, nil)
+	cg.On("get", (*http.Request)(nil), "https://issuer").Return(configuration{IntrospectionEndpoint: server.URL}, nil).Once()
+
+	jt, err := iv.validate(nil, "opaque")
+
+	if err != nil {
+		t.Fatal("An error was returned but not expected.", err)
+	}
+
+	u, err := newUser(jt)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://issuer", u.Issuer)
+	assert.Equal(t, "client", u.ID)
+	assert.Equal(t, []string{"read"}, u.Scopes())
+
+	jt.Claims["scope"] = "write"
+
+	jt, err = iv.validate(nil, "opaque")
+	assert.Nil(t, err)
+	assert.Equal(t, "read", jt.Claims["scope"], "The cached claims should not have been modified.")
+	assert.Equal(t, 1, calls, "The introspection response should have been cached.")
+
+	iv.tv.now = func() time.Time { return testNow.Add(2 * time.Minute) }
+
+	_, err = iv.validate(nil, "opaque")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, calls, "The cached response should have expired after the MaxTTL.")
+
+	// The configuration was retrieved only once.
+	cg.AssertExpectations(t)
+}
+
+func Test_introspectionTokenValidator_validate_WhenTokenIsInactive(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"active": false}`))
+	}))
+	defer server.Close()
+
+	iv, pm, cg := createIntrospectionTokenValidator(t, IntrospectionPolicy{})
+	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}, IntrospectionClientID: "rs"}}, nil)
+	cg.On("get", (*http.Request)(nil), "https://issuer").Return(configuration{IntrospectionEndpoint: server.URL}, nil)
+
+	_, err := iv.validate(nil, "opaque")
+
+	expectValidationError(t, err, ValidationErrorTokenInactive, http.StatusUnauthorized, nil)
+}
+
+func Test_introspectionTokenValidator_validate_WhenActiveTokenExpired(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"active": true, "sub": "user", "exp": ` + fmtUnix(testNow.Add(-time.Hour)) + `}`))
+	}))
+	defer server.Close()
+
+	iv, pm, cg := createIntrospectionTokenValidator(t, IntrospectionPolicy{})
+	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}, IntrospectionClientID: "rs"}}, nil)
+	cg.On("get", (*http.Request)(nil), "https://issuer").Return(configuration{IntrospectionEndpoint: server.URL}, nil)
+
+	_, err := iv.validate(nil, "opaque")
+
+	expectValidationError(t, err, ValidationErrorJwtValidationFailure, http.StatusUnauthorized, nil)
+}
+
+func Test_introspectionTokenValidator_validate_WhenIssuerDoesNotMatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"active": true, "sub": "user", "iss": "https://attacker"}`))
+	}))
+	defer server.Close()
+
+	iv, pm, cg := createIntrospectionTokenValidator(t, IntrospectionPolicy{})
+	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}, IntrospectionClientID: "rs"}}, nil)
+	cg.On("get", (*http.Request)(nil), "https://issuer").Return(configuration{IntrospectionEndpoint: server.URL}, nil)
+
+	_, err := iv.validate(nil, "opaque")
+
+	expectValidationError(t, err, ValidationErrorInvalidIssuer, http.StatusUnauthorized, nil)
+}
+
+func Test_introspectionTokenValidator_validate_WhenTokenIsInactive_CachesResponse(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"active": false}`))
+	}))
+	defer server.Close()
+
+	iv, pm, cg := createIntrospectionTokenValidator(t, IntrospectionPolicy{InactiveTTL: time.Minute})
+	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}, IntrospectionClientID: "rs"}}, nil)
+	cg.On("get", (*http.Request)(nil), "https://issuer").Return(configuration{IntrospectionEndpoint: server.URL}, nil)
+
+	_, err := iv.validate(nil, "opaque")
+	expectValidationError(t, err, ValidationErrorTokenInactive, http.StatusUnauthorized, nil)
+
+	_, err = iv.validate(nil, "opaque")
+	expectValidationError(t, err, ValidationErrorTokenInactive, http.StatusUnauthorized, nil)
+	assert.Equal(t, 1, calls, "The inactive response should have been cached.")
+
+	iv.tv.now = func() time.Time { return testNow.Add(2 * time.Minute) }
+
+	_, err = iv.validate(nil, "opaque")
+	expectValidationError(t, err, ValidationErrorTokenInactive, http.StatusUnauthorized, nil)
+	assert.Equal(t, 2, calls, "The cached response should have expired after the InactiveTTL.")
+}
+
+func Test_introspectionTokenValidator_put_WhenCacheIsFull(t *testing.T) {
+	iv, _, _ := createIntrospectionTokenValidator(t, IntrospectionPolicy{MaxEntries: 2, MaxTTL: time.Hour})
+	p := &Provider{Issuer: "https://issuer"}
+
+	iv.store("late", jwtClaims{"exp": float64(testNow.Add(time.Hour).Unix())}, p)
+	iv.storeInactive("soon")
+	iv.store("expired", jwtClaims{"exp": float64(testNow.Add(-time.Hour).Unix())}, p)
+
+	assert.Len(t, iv.cache, 2, "The expired response should not have been cached.")
+
+	iv.store("new", jwtClaims{"exp": float64(testNow.Add(time.Hour).Unix())}, p)
+
+	assert.Len(t, iv.cache, 2)
+	assert.Len(t, iv.queue, 2)
+	assert.NotContains(t, iv.cache, "soon", "The response expiring first should have been evicted.")
+
+	iv.tv.now = func() time.Time { return testNow.Add(2 * time.Hour) }
+	iv.storeInactive("other")
+
+	assert.Len(t, iv.cache, 1, "The expired responses should have been removed.")
+	assert.Contains(t, iv.cache, "other")
+}
+
+func Test_introspectionTokenValidator_validate_StopsAtFirstActiveResponse(t *testing.T) {
+	inactive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"active": false}`))
+	}))
+	defer inactive.Close()
+
+	active := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"active": true, "client_id": "client"}`))
+	}))
+	defer active.Close()
+
+	iv, pm, cg := createIntrospectionTokenValidator(t, IntrospectionPolicy{})
+	pm.On("get").Return([]Provider{
+		{Issuer: "https://a", ClientIDs: []string{"client"}, IntrospectionClientID: "rs"},
+		{Issuer: "https://b", ClientIDs: []string{"client"}, IntrospectionClientID: "rs"},
+		{Issuer: "https://c", ClientIDs: []string{"client"}, IntrospectionClientID: "rs"},
+	}, nil)
+	cg.On("get", (*http.Request)(nil), "https://a").Return(configuration{IntrospectionEndpoint: inactive.URL}, nil)
+	cg.On("get", (*http.Request)(nil), "https://b").Return(configuration{IntrospectionEndpoint: active.URL}, nil)
+
+	jt, err := iv.validate(nil, "opaque")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "https://b", jt.Claims["iss"])
+	cg.AssertExpectations(t)
+	cg.AssertNotCalled(t, "get", (*http.Request)(nil), "https://c")
+}
+
+func Test_introspectionTokenValidator_validate_WhenIssuerHintIsReturned(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"active": true, "client_id": "client"}`))
+	}))
+	defer server.Close()
+
+	iv, pm, cg := createIntrospectionTokenValidator(t, IntrospectionPolicy{IssuerHint: func(r *http.Request, token string) string {
+		assert.Equal(t, "opaque", token)
+		return "https://b"
+	}})
+	pm.On("get").Return([]Provider{
+		{Issuer: "https://a", ClientIDs: []string{"client"}, IntrospectionClientID: "rs"},
+		{Issuer: "https://b", ClientIDs: []string{"client"}, IntrospectionClientID: "rs"},
+	}, nil)
+	cg.On("get", (*http.Request)(nil), "https://b").Return(configuration{IntrospectionEndpoint: server.URL}, nil)
+
+	jt, err := iv.validate(nil, "opaque")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "https://b", jt.Claims["iss"])
+	cg.AssertExpectations(t)
+	cg.AssertNotCalled(t, "get", (*http.Request)(nil), "https://a")
+}
+
+func Test_introspectionTokenValidator_validate_WhenIssuerHintIsUnknown(t *testing.T) {
+	iv, pm, cg := createIntrospectionTokenValidator(t, IntrospectionPolicy{IssuerHint: func(r *http.Request, token string) string {
+		return "https://other"
+	}})
+	pm.On("get").Return([]Provider{
+		{Issuer: "https://issuer", ClientIDs: []string{"client"}, IntrospectionClientID: "rs"},
+		{Issuer: "https://other", ClientIDs: []string{"client"}},
+	}, nil)
+
+	_, err := iv.validate(nil, "opaque")
+
+	expectValidationError(t, err, ValidationErrorIssuerNotFound, http.StatusUnauthorized, nil)
+	cg.AssertNotCalled(t, "get", mock.Anything, mock.Anything)
+}
+
+func Test_introspectionTokenValidator_validate_WhenAudiencesDoNotMatch(t *testing.T) {
+	for _, tc := range []struct {
+		response string
+		provider Provider
+	}{
+		{`{"active": true, "client_id": "client", "aud": "https://other"}`, Provider{ClientIDs: []string{"client"}}},
+		{`{"active": true, "client_id": "client", "aud": "client"}`, Provider{ClientIDs: []string{"client"}, Audiences: []string{"https://api"}}},
+		{`{"active": true, "client_id": "other"}`, Provider{ClientIDs: []string{"client"}}},
+		{`{"active": true, "sub": "user"}`, Provider{ClientIDs: []string{"client"}}},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(tc.response))
+		}))
+
+		iv, pm, cg := createIntrospectionTokenValidator(t, IntrospectionPolicy{})
+		tc.provider.Issuer = "https://issuer"
+		tc.provider.IntrospectionClientID = "rs"
+		pm.On("get").Return([]Provider{tc.provider}, nil)
+		cg.On("get", (*http.Request)(nil), "https://issuer").Return(configuration{IntrospectionEndpoint: server.URL}, nil)
+
+		_, err := iv.validate(nil, "opaque")
+
+		expectValidationError(t, err, ValidationErrorAudienceNotFound, http.StatusUnauthorized, nil)
+		server.Close()
+	}
+}
+
+func Test_introspectionTokenValidator_validate_WhenTokenIsTooOld(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"active": true, "client_id": "client", "iat": ` + fmtUnix(testNow.Add(-2*time.Hour)) + `}`))
+	}))
+	defer server.Close()
+
+	iv, pm, cg := createIntrospectionTokenValidator(t, IntrospectionPolicy{})
+	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}, IntrospectionClientID: "rs",
+		TokenAge: &TokenAgePolicy{MaxAge: time.Hour}}}, nil)
+	cg.On("get", (*http.Request)(nil), "https://issuer").Return(configuration{IntrospectionEndpoint: server.URL}, nil)
+
+	_, err := iv.validate(nil, "opaque")
+
+	expectValidationError(t, err, ValidationErrorTokenTooOld, http.StatusUnauthorized, nil)
+}
+
+func Test_introspectionTokenValidator_validate_WhenEndpointFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	iv, pm, cg := createIntrospectionTokenValidator(t, IntrospectionPolicy{})
+	pm.On("get").Return([]Provider{
+		{Issuer: "https://a", ClientIDs: []string{"client"}, IntrospectionClientID: "rs"},
+		{Issuer: "https://b", ClientIDs: []string{"client"}, IntrospectionClientID: "rs"},
+	}, nil)
+	cg.On("get", (*http.Request)(nil), "https://a").Return(configuration{IntrospectionEndpoint: server.URL}, nil)
+
+	_, err := iv.validate(nil, "opaque")
+
+	expectValidationError(t, err, ValidationErrorIntrospectionFailure, http.StatusUnauthorized, nil)
+	cg.AssertExpectations(t)
+	cg.AssertNotCalled(t, "get", (*http.Request)(nil), "https://b")
+}
+
+func Test_introspectionTokenValidator_validate_WhenEndpointFails_RetrievesConfigurationAgain(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer failing.Close()
+
+	moved := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"active": true, "client_id": "client"}`))
+	}))
+	defer moved.Close()
+
+	iv, pm, cg := createIntrospectionTokenValidator(t, IntrospectionPolicy{})
+	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}, IntrospectionClientID: "rs"}}, nil)
+	cg.On("get", (*http.Request)(nil), "https://issuer").Return(configuration{IntrospectionEndpoint: failing.URL}, nil).Once()
+	cg.On("get", (*http.Request)(nil), "https://issuer").Return(configuration{IntrospectionEndpoint: moved.URL}, nil).Once()
+
+	_, err := iv.validate(nil, "opaque")
+	expectValidationError(t, err, ValidationErrorIntrospectionFailure, http.StatusUnauthorized, nil)
+
+	_, err = iv.validate(nil, "opaque")
+	assert.Nil(t, err)
+
+	_, err = iv.validate(nil, "other")
+	assert.Nil(t, err)
+
+	cg.AssertExpectations(t)
+}
+
+func Test_introspectionTokenValidator_validate_WhenNoEndpointIsPublished(t *testing.T) {
+	iv, pm, cg := createIntrospectionTokenValidator(t, IntrospectionPolicy{})
+	pm.On("get").Return([]Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}, IntrospectionClientID: "rs"}}, nil)
+	cg.On("get", (*http.Request)(nil), "https://issuer").Return(configuration{}, nil)
+
+	_, err := iv.validate(nil, "opaque")
+
+	expectValidationError(t, err, ValidationErrorIntrospectionNotSupported, http.StatusUnauthorized, nil)
+}
+
+func Test_TokenIntrospection_WhenPolicyIsInvalid(t *testing.T) {
+	_, err := NewConfiguration(TokenIntrospection(IntrospectionPolicy{MaxTTL: -time.Second}))
+
+	expectSetupError(t, err, SetupErrorInvalidIntrospectionPolicy)
+
+	_, err = NewConfiguration(TokenIntrospection(IntrospectionPolicy{InactiveTTL: -time.Second}))
+
+	expectSetupError(t, err, SetupErrorInvalidIntrospectionPolicy)
+
+	_, err = NewConfiguration(TokenIntrospection(IntrospectionPolicy{MaxEntries: -1}))
+
+	expectSetupError(t, err, SetupErrorInvalidIntrospectionPolicy)
+}
+
+func Test_providerConfigurationGetter_get_WhenCircuitIsOpen(t *testing.T) {
+	configGetter, _, _, skProv := createSigningKeySetProvider(t)
+	_, cb, _ := createCircuitBreaker(t, 1)
+	pg := &providerConfigurationGetter{ksp: skProv, cb: cb}
+
+	iss := "https://issuer"
+	ee := &ValidationError{Code: ValidationErrorGetOpenIdConfigurationFailure, HTTPStatus: http.StatusUnauthorized}
+	configGetter.On("get", (*http.Request)(nil), iss).Return(configuration{}, ee).Once()
+
+	_, err := pg.get(nil, iss)
+	expectValidationError(t, err, ee.Code, ee.HTTPStatus, nil)
+
+	// The circuit is now open and the configuration is not retrieved again.
+	_, err = pg.get(nil, iss)
+	expectValidationError(t, err, ValidationErrorCircuitOpen, http.StatusUnauthorized, nil)
+
+	configGetter.AssertExpectations(t)
+}
+
+func createIntrospectionTokenValidator(t *testing.T, ip IntrospectionPolicy) (*introspectionTokenValidator, *mockProvidersGetter, *mockConfigurationGetter) {
+	pm, _, _, _, tv := createIDTokenValidator(t)
+	tv.now = func() time.Time { return testNow }
+	cg := &mockConfigurationGetter{}
+
+	return newIntrospectionTokenValidator(tv, tv, cg, ip), pm, cg
+}
+
+func fmtUnix(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
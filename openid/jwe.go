@@ -0,0 +1,201 @@
+package openid
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"strings"
+
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const encryptionHeaderName = "enc"
+
+var defaultKeyEncryptionAlgorithms = []string{
+	string(jose.RSA_OAEP),
+	string(jose.RSA_OAEP_256),
+	string(jose.ECDH_ES),
+	string(jose.ECDH_ES_A128KW),
+	string(jose.ECDH_ES_A192KW),
+	string(jose.ECDH_ES_A256KW),
+}
+
+var defaultContentEncryptionAlgorithms = []string{
+	string(jose.A128GCM),
+	string(jose.A192GCM),
+	string(jose.A256GCM),
+	string(jose.A128CBC_HS256),
+	string(jose.A192CBC_HS384),
+	string(jose.A256CBC_HS512),
+}
+
+// DecryptionPolicy determines how the encrypted ID Tokens, the JWEs requested from the OPs with
+// the id_token_encrypted_response_alg client metadata, are decrypted.
+//
+// The Keys contains the private keys of the client, each one a *rsa.PrivateKey, a *ecdsa.PrivateKey,
+// a jose.JSONWebKey or a *jose.JSONWebKey holding one of them. The keys are tried in order, skipping
+// the JSON Web Keys whose key id does not match the 'kid' header of the token when both are set.
+//
+// The KeyAlgorithms contains the key management algorithms ('alg' header) allowed. When empty
+// RSA-OAEP, RSA-OAEP-256, ECDH-ES and ECDH-ES with AES key wrapping are allowed.
+//
+// The ContentEncryptions contains the content encryption algorithms ('enc' header) allowed. When
+// empty the AES GCM and AES CBC HMAC SHA2 algorithms are allowed.
+type DecryptionPolicy struct {
+	Keys               []interface{}
+	KeyAlgorithms      []string
+	ContentEncryptions []string
+}
+
+// TokenDecryption option enables the decryption of the ID Tokens encrypted to the client. The
+// tokens must be nested JWTs, i.e.: signed and then encrypted, the signed token being decrypted
+// before its signature and claims are validated as usual.
+// When this option is not used the encrypted tokens are rejected as malformed JWTs.
+func TokenDecryption(dp DecryptionPolicy) func(*Configuration) error {
+	return func(c *Configuration) error {
+		if len(dp.Keys) == 0 {
+			return &SetupError{
+				Code:    SetupErrorInvalidDecryptionPolicy,
+				Message: "At least one decryption key must be provided.",
+			}
+		}
+
+		for i, k := range dp.Keys {
+			if !isDecryptionKey(k) {
+				return &SetupError{
+					Code:    SetupErrorInvalidDecryptionPolicy,
+					Message: fmt.Sprintf("The decryption key at index %v of type %T is not supported.", i, k),
+				}
+			}
+		}
+
+		if len(dp.KeyAlgorithms) == 0 {
+			dp.KeyAlgorithms = defaultKeyEncryptionAlgorithms
+		}
+
+		if len(dp.ContentEncryptions) == 0 {
+			dp.ContentEncryptions = defaultContentEncryptionAlgorithms
+		}
+
+		c.decryptionPolicy = &dp
+		return nil
+	}
+}
+
+func isDecryptionKey(k interface{}) bool {
+	switch k := k.(type) {
+	case *rsa.PrivateKey:
+		return k != nil
+	case *ecdsa.PrivateKey:
+		return k != nil
+	case jose.JSONWebKey:
+		return isDecryptionKey(k.Key)
+	case *jose.JSONWebKey:
+		return k != nil && isDecryptionKey(k.Key)
+	}
+
+	return false
+}
+
+type decryptingTokenValidator struct {
+	next   jwtTokenValidator
+	policy DecryptionPolicy
+}
+
+// newDecryptingTokenValidator returns the validator decrypting the encrypted tokens and forwarding
+// the signed tokens they contain to next. The other tokens are forwarded unchanged.
+func newDecryptingTokenValidator(next jwtTokenValidator, dp DecryptionPolicy) *decryptingTokenValidator {
+	return &decryptingTokenValidator{next: next, policy: dp}
+}
+
+func (dv *decryptingTokenValidator) validate(r *http.Request, t string) (*jwtToken, error) {
+	if strings.Count(t, ".") != 4 {
+		return dv.next.validate(r, t)
+	}
+
+	st, err := dv.decrypt(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return dv.next.validate(r, st)
+}
+
+// decrypt returns the signed token contained in the encrypted token.
+func (dv *decryptingTokenValidator) decrypt(t string) (string, error) {
+	obj, err := jose.ParseEncrypted(t)
+	if err != nil {
+		return "", &ValidationError{
+			Code:       ValidationErrorDecryptionFailure,
+			Message:    "The encrypted token could not be parsed.",
+			Err:        err,
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	alg := obj.Header.Algorithm
+	enc, _ := obj.Header.ExtraHeaders[jose.HeaderKey(encryptionHeaderName)].(string)
+	if !contains(dv.policy.KeyAlgorithms, alg) || !contains(dv.policy.ContentEncryptions, enc) {
+		return "", &ValidationError{
+			Code:       ValidationErrorUnsupportedEncryptionAlgorithm,
+			Message:    fmt.Sprintf("The token is encrypted with the algorithms %v and %v which are not allowed.", alg, enc),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	var lastErr error
+	for _, k := range dv.policy.Keys {
+		if !matchesKeyID(k, obj.Header.KeyID) {
+			continue
+		}
+
+		pt, err := obj.Decrypt(k)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		st := string(pt)
+		if strings.Count(st, ".") != 2 {
+			return "", &ValidationError{
+				Code:       ValidationErrorDecryptionFailure,
+				Message:    "The encrypted token does not contain a signed token.",
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+
+		return st, nil
+	}
+
+	return "", &ValidationError{
+		Code:       ValidationErrorDecryptionFailure,
+		Message:    "The encrypted token could not be decrypted with any of the keys.",
+		Err:        lastErr,
+		HTTPStatus: http.StatusUnauthorized,
+	}
+}
+
+func matchesKeyID(k interface{}, kid string) bool {
+	var jwk *jose.JSONWebKey
+	switch k := k.(type) {
+	case jose.JSONWebKey:
+		jwk = &k
+	case *jose.JSONWebKey:
+		jwk = k
+	default:
+		return true
+	}
+
+	return kid == "" || jwk.KeyID == "" || jwk.KeyID == kid
+}
+
+func contains(values []string, v string) bool {
+	for _, e := range values {
+		if e == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -31,6 +31,11 @@ func (httpProv *httpJwksProvider) get(r *http.Request, url string) (jose.JSONWeb
 	resp, err := httpProv.getter.get(r, url)
 
 	if err != nil {
+		// Restrictions enforced on redirects are surfaced as they are.
+		if verr, ok := policyViolation(err); ok {
+			return jwks, verr
+		}
+
 		return jwks, &ValidationError{
 			Code:       ValidationErrorGetJwksFailure,
 			Message:    fmt.Sprintf("Failure while contacting the jwk endpoint %v.", url),
@@ -41,6 +46,15 @@ func (httpProv *httpJwksProvider) get(r *http.Request, url string) (jose.JSONWeb
 
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return jwks, &ValidationError{
+			Code:       ValidationErrorGetJwksFailure,
+			Message:    fmt.Sprintf("Failure while contacting the jwk endpoint %v.", url),
+			Err:        fmt.Errorf("the endpoint responded with the status %v", resp.Status),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
 	if jwks, err = httpProv.decoder.decode(resp.Body); err != nil {
 		return jwks, &ValidationError{
 			Code:       ValidationErrorDecodeJwksFailure,
@@ -126,3 +126,17 @@ func TestJwksProvider_Get_WhenDecodeResponseSucceeds(t *testing.T) {
 	httpGetter.AssertExpectations(t)
 	jwksDecoder.AssertExpectations(t)
 }
+
+func TestJwksProvider_Get_WhenEndpointFails(t *testing.T) {
+	httpGetter := &mockHTTPGetter{}
+	jwksProvider := httpJwksProvider{getter: httpGetter}
+
+	resp := &http.Response{StatusCode: http.StatusInternalServerError, Status: "500 Internal Server Error", Body: testBody{bytes.NewBufferString("")}}
+	httpGetter.On("get", (*http.Request)(nil), mock.Anything).Return(resp, nil)
+
+	_, e := jwksProvider.get(nil, mock.Anything)
+
+	expectValidationError(t, e, ValidationErrorGetJwksFailure, http.StatusUnauthorized, nil)
+
+	httpGetter.AssertExpectations(t)
+}
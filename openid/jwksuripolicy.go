@@ -0,0 +1,255 @@
+package openid
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultJwksTimeout = 10 * time.Second
+
+// JwksURIPolicy restricts the locations the jwks_uri published in the OP configuration
+// may point to before the signing keys are retrieved from it.
+//
+// The RequireHTTPS determines whether the jwks_uri must use the https scheme.
+//
+// The jwks_uri host must be the same as the host of the issuer or of the metadata endpoint
+// the configuration was retrieved from, unless it is listed in AllowedHosts or in the
+// AllowedJwksHosts of the respective Provider.
+//
+// The AllowPrivateIPs determines whether the jwk set may be retrieved from loopback, private,
+// link-local or unspecified IP addresses. The addresses are verified when connecting to them,
+// so a host resolving to a different address after being checked can not bypass it.
+//
+// The MaxRedirects is the maximum number of redirects followed when retrieving the jwk set,
+// each redirect target being subject to the same restrictions, including the allowed hosts.
+//
+// The Timeout is the maximum time taken to retrieve the jwk set, including the redirects.
+// When zero it defaults to 10 seconds.
+//
+// The AllowPrivateIPs, MaxRedirects and Timeout only apply when the default HTTP getter is
+// used, if the HTTPGetter option is used the registered function is responsible for them.
+type JwksURIPolicy struct {
+	RequireHTTPS    bool
+	AllowedHosts    []string
+	AllowPrivateIPs bool
+	MaxRedirects    int
+	Timeout         time.Duration
+}
+
+// JwksURIRestrictions option registers the policy used to validate the jwks_uri published by
+// the OPs. When this option is not used the jwks_uri is retrieved without restrictions.
+func JwksURIRestrictions(jp JwksURIPolicy) func(*Configuration) error {
+	return func(c *Configuration) error {
+		c.jwksURIPolicy = &jp
+		return nil
+	}
+}
+
+type jwksLocationKey struct{}
+
+// jwksLocation is what the jwk set being retrieved was published for, the redirects followed
+// while retrieving it must point to the hosts allowed for it.
+type jwksLocation struct {
+	p        *Provider
+	iss      string
+	endpoint string
+}
+
+// withJwksLocation returns a copy of the request carrying the provider, issuer and metadata
+// endpoint the jwk set is retrieved for.
+func withJwksLocation(r *http.Request, p *Provider, iss string, endpoint string) *http.Request {
+	if r == nil {
+		r, _ = http.NewRequest(http.MethodGet, "", nil)
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), jwksLocationKey{}, jwksLocation{p, iss, endpoint}))
+}
+
+type jwksURIValidator struct {
+	policy   JwksURIPolicy
+	lookupIP func(ctx context.Context, host string) ([]net.IPAddr, error)
+	dialer   *net.Dialer
+	client   *http.Client
+}
+
+func newJwksURIValidator(jp JwksURIPolicy) *jwksURIValidator {
+	v := &jwksURIValidator{policy: jp, lookupIP: net.DefaultResolver.LookupIPAddr, dialer: &net.Dialer{}}
+	v.client = v.newClient()
+	return v
+}
+
+// validate verifies the jwks_uri retrieved for the issuer from the given metadata endpoint.
+func (v *jwksURIValidator) validate(p *Provider, iss string, endpoint string, jwksURI string) error {
+	u, err := url.Parse(jwksURI)
+	if err != nil || u.Host == "" {
+		return &ValidationError{
+			Code:       ValidationErrorJwksURIInvalid,
+			Message:    fmt.Sprintf("The jwks_uri %v published for the issuer %v is not a valid URL.", jwksURI, iss),
+			Err:        err,
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	if !v.hostAllowed(p, u.Hostname(), iss, endpoint) {
+		return &ValidationError{
+			Code:       ValidationErrorJwksURIHostNotAllowed,
+			Message:    fmt.Sprintf("The jwks_uri %v published for the issuer %v points to a host that is not allowed.", jwksURI, iss),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	return v.validateLocation(u)
+}
+
+// validateLocation verifies the scheme restriction that applies to the jwks_uri and to every
+// redirect followed from it. The addresses are verified by dialContext.
+func (v *jwksURIValidator) validateLocation(u *url.URL) error {
+	if v.policy.RequireHTTPS && u.Scheme != "https" {
+		return &ValidationError{
+			Code:       ValidationErrorJwksURIInsecure,
+			Message:    fmt.Sprintf("The jwks location %v does not use https.", u),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	return nil
+}
+
+// validateRedirect verifies that the redirect points to a host allowed for the jwk set being
+// retrieved, and then the same restrictions as the jwks_uri.
+func (v *jwksURIValidator) validateRedirect(req *http.Request) error {
+	loc, ok := req.Context().Value(jwksLocationKey{}).(jwksLocation)
+	if !ok || !v.hostAllowed(loc.p, req.URL.Hostname(), loc.iss, loc.endpoint) {
+		return &ValidationError{
+			Code:       ValidationErrorJwksURIHostNotAllowed,
+			Message:    fmt.Sprintf("The jwks location redirected to %v, a host that is not allowed.", req.URL.Host),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	return v.validateLocation(req.URL)
+}
+
+// dialContext resolves the host of the address and connects to the first of its IP addresses
+// that accepts the connection, after verifying that none of them is private.
+func (v *jwksURIValidator) dialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := []net.IPAddr{{IP: net.ParseIP(host)}}
+	if ips[0].IP == nil {
+		if ips, err = v.lookupIP(ctx, host); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ip := range ips {
+		if isPrivateIP(ip.IP) {
+			return nil, &ValidationError{
+				Code:       ValidationErrorJwksURIPrivateAddress,
+				Message:    fmt.Sprintf("The jwks location %v resolves to the private address %v.", host, ip.IP),
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+	}
+
+	for _, ip := range ips {
+		var conn net.Conn
+		if conn, err = v.dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+			return conn, nil
+		}
+	}
+
+	if err == nil {
+		err = fmt.Errorf("the host %v has no addresses", host)
+	}
+
+	return nil, err
+}
+
+func (v *jwksURIValidator) hostAllowed(p *Provider, host string, iss string, endpoint string) bool {
+	for _, h := range []string{iss, endpoint} {
+		if u, err := url.Parse(h); err == nil && strings.EqualFold(u.Hostname(), host) {
+			return true
+		}
+	}
+
+	allowed := v.policy.AllowedHosts
+	if p != nil {
+		allowed = append(allowed[:len(allowed):len(allowed)], p.AllowedJwksHosts...)
+	}
+
+	for _, h := range allowed {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newClient returns an http client that enforces the policy on the addresses it connects to and
+// on the redirects it follows.
+func (v *jwksURIValidator) newClient() *http.Client {
+	timeout := v.policy.Timeout
+	if timeout <= 0 {
+		timeout = defaultJwksTimeout
+	}
+
+	t := &http.Transport{TLSHandshakeTimeout: timeout}
+	if !v.policy.AllowPrivateIPs {
+		t.DialContext = v.dialContext
+	}
+
+	return &http.Client{
+		Transport: t,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > v.policy.MaxRedirects {
+				return &ValidationError{
+					Code:       ValidationErrorJwksURITooManyRedirects,
+					Message:    fmt.Sprintf("The jwks location redirected more than %v times.", v.policy.MaxRedirects),
+					HTTPStatus: http.StatusUnauthorized,
+				}
+			}
+
+			return v.validateRedirect(req)
+		},
+	}
+}
+
+func (v *jwksURIValidator) httpGet(r *http.Request, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if r != nil {
+		req = req.WithContext(r.Context())
+	}
+
+	return v.client.Do(req)
+}
+
+func isPrivateIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4[0] == 10 ||
+			(ip4[0] == 172 && ip4[1]&0xf0 == 16) ||
+			(ip4[0] == 192 && ip4[1] == 168) ||
+			(ip4[0] == 100 && ip4[1]&0xc0 == 64)
+	}
+
+	// Unique local addresses fc00::/7.
+	return len(ip) == net.IPv6len && ip[0]&0xfe == 0xfc
+}
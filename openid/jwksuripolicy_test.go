@@ -0,0 +1,203 @@
+package openid
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_jwksURIValidator_validate_WhenURIIsInvalid(t *testing.T) {
+	v := createJwksURIValidator(JwksURIPolicy{}, "8.8.8.8")
+
+	err := v.validate(nil, "https://issuer", "https://issuer", "/jwks")
+
+	expectValidationError(t, err, ValidationErrorJwksURIInvalid, http.StatusUnauthorized, nil)
+}
+
+func Test_jwksURIValidator_validate_WhenSchemeIsNotHTTPS(t *testing.T) {
+	v := createJwksURIValidator(JwksURIPolicy{RequireHTTPS: true}, "8.8.8.8")
+
+	err := v.validate(nil, "https://issuer", "https://issuer", "http://issuer/jwks")
+
+	expectValidationError(t, err, ValidationErrorJwksURIInsecure, http.StatusUnauthorized, nil)
+}
+
+func Test_jwksURIValidator_validate_WhenHostIsNotAllowed(t *testing.T) {
+	v := createJwksURIValidator(JwksURIPolicy{}, "8.8.8.8")
+
+	err := v.validate(nil, "https://issuer", "https://issuer", "https://attacker/jwks")
+
+	expectValidationError(t, err, ValidationErrorJwksURIHostNotAllowed, http.StatusUnauthorized, nil)
+}
+
+func Test_jwksURIValidator_validate_WhenHostIsAllowed(t *testing.T) {
+	v := createJwksURIValidator(JwksURIPolicy{RequireHTTPS: true, AllowedHosts: []string{"keys.global"}}, "8.8.8.8")
+	p := &Provider{Issuer: "https://issuer", AllowedJwksHosts: []string{"keys.issuer"}}
+
+	for _, uri := range []string{
+		"https://issuer/jwks",
+		"https://eu.issuer/jwks",
+		"https://keys.global/jwks",
+		"https://KEYS.issuer:8443/jwks",
+	} {
+		if err := v.validate(p, "https://issuer", "https://eu.issuer", uri); err != nil {
+			t.Error("An error was returned but not expected for", uri, err)
+		}
+	}
+}
+
+func Test_jwksURIValidator_httpGet_WhenHostResolvesToPrivateAddress(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "::1", "fd00::1"} {
+		v := createJwksURIValidator(JwksURIPolicy{}, ip)
+		jp := newHTTPJwksProvider(v.httpGet, &jsonJwksDecoder{})
+
+		_, err := jp.get(nil, "http://issuer/jwks")
+
+		expectValidationError(t, err, ValidationErrorJwksURIPrivateAddress, http.StatusUnauthorized, nil)
+	}
+}
+
+func Test_jwksURIValidator_httpGet_WhenPrivateAddressesAreAllowed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer server.Close()
+
+	v := newJwksURIValidator(JwksURIPolicy{AllowPrivateIPs: true})
+	jp := newHTTPJwksProvider(v.httpGet, &jsonJwksDecoder{})
+
+	if _, err := jp.get(nil, server.URL+"/jwks"); err != nil {
+		t.Error("An error was returned but not expected", err)
+	}
+}
+
+func Test_jwksURIValidator_httpGet_WhenHostCanNotBeResolved(t *testing.T) {
+	le := errors.New("no such host")
+	v := newJwksURIValidator(JwksURIPolicy{})
+	v.lookupIP = func(ctx context.Context, host string) ([]net.IPAddr, error) { return nil, le }
+	jp := newHTTPJwksProvider(v.httpGet, &jsonJwksDecoder{})
+
+	_, err := jp.get(nil, "https://issuer/jwks")
+
+	expectValidationError(t, err, ValidationErrorGetJwksFailure, http.StatusUnauthorized, nil)
+}
+
+func Test_jwksURIValidator_httpGet_WhenTimeoutExpires(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	v := newJwksURIValidator(JwksURIPolicy{AllowPrivateIPs: true, Timeout: 20 * time.Millisecond})
+	jp := newHTTPJwksProvider(v.httpGet, &jsonJwksDecoder{})
+
+	_, err := jp.get(nil, server.URL+"/jwks")
+
+	expectValidationError(t, err, ValidationErrorGetJwksFailure, http.StatusUnauthorized, nil)
+}
+
+func Test_retryHTTPGetter_get_DoesNotRetryPolicyViolations(t *testing.T) {
+	v := createJwksURIValidator(JwksURIPolicy{}, "169.254.169.254")
+	attempts := 0
+	rg := newRetryHTTPGetter(HTTPGetFunc(func(r *http.Request, url string) (*http.Response, error) {
+		attempts++
+		return v.httpGet(r, url)
+	}), RetryPolicy{MaxAttempts: 3})
+	rg.wait = func(r *http.Request, d time.Duration) error { return nil }
+
+	_, err := newHTTPJwksProvider(rg.get, &jsonJwksDecoder{}).get(nil, "http://issuer/jwks")
+
+	expectValidationError(t, err, ValidationErrorJwksURIPrivateAddress, http.StatusUnauthorized, nil)
+
+	if attempts != 1 {
+		t.Error("Expected a single attempt but got", attempts)
+	}
+}
+
+func Test_jwksURIValidator_httpGet_WhenRedirectsExceedMax(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server.URL+r.URL.Path+"x", http.StatusFound)
+	}))
+	defer server.Close()
+
+	v := newJwksURIValidator(JwksURIPolicy{AllowPrivateIPs: true, MaxRedirects: 2})
+	jp := newHTTPJwksProvider(v.httpGet, &jsonJwksDecoder{})
+
+	_, err := jp.get(withJwksLocation(nil, nil, server.URL, server.URL), server.URL+"/jwks")
+
+	expectValidationError(t, err, ValidationErrorJwksURITooManyRedirects, http.StatusUnauthorized, nil)
+}
+
+func Test_jwksURIValidator_httpGet_WhenRedirectTargetIsPrivate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+	}))
+	defer server.Close()
+
+	v := newJwksURIValidator(JwksURIPolicy{AllowedHosts: []string{"169.254.169.254"}, MaxRedirects: 1})
+	jp := newHTTPJwksProvider(v.httpGet, &jsonJwksDecoder{})
+
+	_, err := jp.get(withJwksLocation(nil, nil, server.URL, server.URL), server.URL+"/jwks")
+
+	expectValidationError(t, err, ValidationErrorJwksURIPrivateAddress, http.StatusUnauthorized, nil)
+}
+
+func Test_jwksURIValidator_httpGet_WhenRedirectTargetIsNotAllowed(t *testing.T) {
+	called := false
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace(other.URL, "127.0.0.1", "localhost", 1)+"/jwks", http.StatusFound)
+	}))
+	defer server.Close()
+
+	v := newJwksURIValidator(JwksURIPolicy{AllowPrivateIPs: true, MaxRedirects: 1})
+	jp := newHTTPJwksProvider(v.httpGet, &jsonJwksDecoder{})
+	p := &Provider{Issuer: "https://issuer", AllowedJwksHosts: []string{"127.0.0.1"}}
+
+	_, err := jp.get(withJwksLocation(nil, p, p.Issuer, p.Issuer), server.URL+"/jwks")
+
+	expectValidationError(t, err, ValidationErrorJwksURIHostNotAllowed, http.StatusUnauthorized, nil)
+
+	if called {
+		t.Error("The disallowed redirect target should not have been contacted.")
+	}
+}
+
+func TestSigningKeySetProvider_Get_WhenJwksURIIsNotAllowed(t *testing.T) {
+	configGetter, jwksGetter, _, skProv := createSigningKeySetProvider(t)
+	skProv.jwksValidator = createJwksURIValidator(JwksURIPolicy{}, "8.8.8.8")
+
+	configGetter.On("get", (*http.Request)(nil), "https://issuer").Return(configuration{Issuer: "https://issuer", JwksURI: "https://attacker/jwks"}, nil)
+
+	sk, re := skProv.get(nil, "https://issuer")
+
+	expectValidationError(t, re, ValidationErrorJwksURIHostNotAllowed, http.StatusUnauthorized, nil)
+
+	if sk != nil {
+		t.Error("The returned signing keys should be nil")
+	}
+
+	configGetter.AssertExpectations(t)
+	jwksGetter.AssertNotCalled(t, "get", mock.Anything, mock.Anything)
+}
+
+func createJwksURIValidator(jp JwksURIPolicy, ip string) *jwksURIValidator {
+	v := newJwksURIValidator(jp)
+	v.lookupIP = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP(ip)}}, nil
+	}
+
+	return v
+}
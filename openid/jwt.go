@@ -0,0 +1,134 @@
+package openid
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// jwtToken is a JWT in the JWS compact serialization. The Header and Claims are decoded from the
+// token before its signature is verified, they can only be trusted once parse returns successfully.
+type jwtToken struct {
+	Raw    string
+	Header map[string]interface{}
+	Claims jwtClaims
+}
+
+// jwtClaims contains the claims of a JWT as decoded from JSON: the numbers are float64, the
+// arrays []interface{} and the objects map[string]interface{}.
+type jwtClaims map[string]interface{}
+
+// jwtKeyFunc returns the key used to verify the signature of the token.
+type jwtKeyFunc func(*jwtToken) (interface{}, error)
+
+type jwtErrorKind int
+
+const (
+	// jwtErrorMalformed indicates the token is not a JWS in compact serialization with a JSON payload.
+	jwtErrorMalformed jwtErrorKind = iota + 1
+	// jwtErrorUnsupportedAlgorithm indicates the token is not signed with an asymmetric algorithm.
+	jwtErrorUnsupportedAlgorithm
+	// jwtErrorUnverifiable indicates the key to verify the token could not be retrieved.
+	jwtErrorUnverifiable
+	// jwtErrorSignatureInvalid indicates the token signature does not match the key.
+	jwtErrorSignatureInvalid
+)
+
+// jwtError is the error returned by parseJWT. The Err is the error returned by the jwtKeyFunc or
+// by go-jose.
+type jwtError struct {
+	Kind jwtErrorKind
+	Err  error
+}
+
+func (e *jwtError) Error() string {
+	var m string
+	switch e.Kind {
+	case jwtErrorMalformed:
+		m = "token is malformed"
+	case jwtErrorUnsupportedAlgorithm:
+		m = "token signing algorithm is not supported"
+	case jwtErrorUnverifiable:
+		m = "token is unverifiable"
+	case jwtErrorSignatureInvalid:
+		m = "token signature is invalid"
+	default:
+		m = "token is invalid"
+	}
+
+	if e.Err != nil {
+		return fmt.Sprintf("%v: %v", m, e.Err)
+	}
+
+	return m
+}
+
+// signingAlgorithms contains the signing algorithms accepted by parseJWT, the symmetric and the
+// 'none' algorithms are rejected since the keys are published by the OPs. EdDSA is not accepted
+// since the Ed25519 keys can not be encoded as PKIX keys by the supported Go versions.
+var signingAlgorithms = map[string]bool{
+	string(jose.RS256): true,
+	string(jose.RS384): true,
+	string(jose.RS512): true,
+	string(jose.PS256): true,
+	string(jose.PS384): true,
+	string(jose.PS512): true,
+	string(jose.ES256): true,
+	string(jose.ES384): true,
+	string(jose.ES512): true,
+}
+
+// parseJWT decodes the token, retrieves the key to verify it with the keyFunc and verifies its
+// signature with go-jose. The time based claims are not validated.
+func parseJWT(t string, keyFunc jwtKeyFunc) (*jwtToken, error) {
+	segments := strings.Split(t, ".")
+	if len(segments) != 3 {
+		return nil, &jwtError{Kind: jwtErrorMalformed, Err: errors.New("the token must have three segments")}
+	}
+
+	obj, err := jose.ParseSigned(t)
+	if err != nil {
+		return nil, &jwtError{Kind: jwtErrorMalformed, Err: err}
+	}
+
+	jt := &jwtToken{Raw: t}
+	if err := decodeSegment(segments[0], &jt.Header); err != nil {
+		return nil, &jwtError{Kind: jwtErrorMalformed, Err: err}
+	}
+
+	if err := json.Unmarshal(obj.UnsafePayloadWithoutVerification(), &jt.Claims); err != nil || jt.Claims == nil {
+		if err == nil {
+			err = errors.New("the token payload must be a JSON object")
+		}
+
+		return nil, &jwtError{Kind: jwtErrorMalformed, Err: err}
+	}
+
+	if alg, _ := jt.Header[algorithmJwtHeaderName].(string); !signingAlgorithms[alg] {
+		return nil, &jwtError{Kind: jwtErrorUnsupportedAlgorithm, Err: fmt.Errorf("the algorithm %q is not allowed", alg)}
+	}
+
+	key, err := keyFunc(jt)
+	if err != nil {
+		return nil, &jwtError{Kind: jwtErrorUnverifiable, Err: err}
+	}
+
+	if _, err := obj.Verify(key); err != nil {
+		return nil, &jwtError{Kind: jwtErrorSignatureInvalid, Err: err}
+	}
+
+	return jt, nil
+}
+
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
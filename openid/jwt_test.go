@@ -0,0 +1,220 @@
+package openid
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+func Test_parseJWT_WhenSignatureIsValid(t *testing.T) {
+	k := generateRSAKey(t)
+	raw := signToken(t, jose.RS256, k, `{"iss":"https://issuer","sub":"user1","exp":1000}`)
+
+	var kjt *jwtToken
+	jt, err := parseJWT(raw, func(tok *jwtToken) (interface{}, error) {
+		kjt = tok
+		return &k.PublicKey, nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, jt, kjt)
+	assert.Equal(t, raw, jt.Raw)
+	assert.Equal(t, "RS256", jt.Header["alg"])
+	assert.Equal(t, jwtClaims{"iss": "https://issuer", "sub": "user1", "exp": 1000.0}, jt.Claims)
+}
+
+func Test_validate_WhenSignedWithECDSA(t *testing.T) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &k.PublicKey, KeyID: "kid", Algorithm: "ES256", Use: "sig"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewConfiguration(
+		ProvidersGetter(func() ([]Provider, error) {
+			return []Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}}}, nil
+		}),
+		HTTPGetter(func(r *http.Request, url string) (*http.Response, error) {
+			body := `{"issuer": "https://issuer", "jwks_uri": "https://issuer/jwks"}`
+			if url == "https://issuer/jwks" {
+				body = string(jwks)
+			}
+
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(body))}, nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := signToken(t, jose.ES256, jose.JSONWebKey{Key: k, KeyID: "kid", Algorithm: "ES256"},
+		`{"iss":"https://issuer","aud":"client","sub":"user1","exp":`+fmtUnix(time.Now().Add(time.Hour))+`}`)
+
+	jt, err := c.tokenValidator.validate(nil, raw)
+
+	if err != nil {
+		t.Fatal("An error was returned but not expected.", err)
+	}
+
+	assert.Equal(t, "user1", jt.Claims["sub"])
+}
+
+func Test_parseJWT_WhenSignatureIsInvalid(t *testing.T) {
+	raw := signToken(t, jose.RS256, generateRSAKey(t), `{"sub":"user1"}`)
+	other := generateRSAKey(t)
+
+	_, err := parseJWT(raw, func(*jwtToken) (interface{}, error) { return &other.PublicKey, nil })
+
+	expectJwtError(t, err, jwtErrorSignatureInvalid)
+}
+
+func Test_parseJWT_WhenTokenIsMalformed(t *testing.T) {
+	k := generateRSAKey(t)
+	keyFunc := func(*jwtToken) (interface{}, error) {
+		t.Error("The key should not be retrieved for a malformed token.")
+		return &k.PublicKey, nil
+	}
+
+	for _, raw := range []string{
+		"",
+		"a.b",
+		"a.b.c.d.e",
+		"!!!.b.c",
+		signToken(t, jose.RS256, k, `["not", "an", "object"]`),
+		signToken(t, jose.RS256, k, `null`),
+	} {
+		_, err := parseJWT(raw, keyFunc)
+		expectJwtError(t, err, jwtErrorMalformed)
+	}
+}
+
+func Test_parseJWT_WhenAlgorithmIsSymmetric(t *testing.T) {
+	raw := signToken(t, jose.HS256, []byte("0123456789abcdef0123456789abcdef"), `{"sub":"user1"}`)
+
+	_, err := parseJWT(raw, func(*jwtToken) (interface{}, error) {
+		t.Error("The key should not be retrieved for a token signed with a symmetric algorithm.")
+		return nil, nil
+	})
+
+	expectJwtError(t, err, jwtErrorUnsupportedAlgorithm)
+}
+
+func Test_parseJWT_WhenAlgorithmIsNone(t *testing.T) {
+	enc := base64.RawURLEncoding.EncodeToString
+	raw := enc([]byte(`{"alg":"none"}`)) + "." + enc([]byte(`{"sub":"user1"}`)) + "."
+
+	_, err := parseJWT(raw, func(*jwtToken) (interface{}, error) { return nil, nil })
+
+	assert.Error(t, err)
+}
+
+func Test_parseJWT_WhenKeyFuncReturnsError(t *testing.T) {
+	k := generateRSAKey(t)
+	raw := signToken(t, jose.RS256, k, `{"sub":"user1"}`)
+	ke := errors.New("key not found")
+
+	_, err := parseJWT(raw, func(*jwtToken) (interface{}, error) { return nil, ke })
+
+	expectJwtError(t, err, jwtErrorUnverifiable)
+	assert.Equal(t, ke, err.(*jwtError).Err)
+}
+
+func Test_jwtErrorToOpenIDError(t *testing.T) {
+	ke := errors.New("key not found")
+	ve := &ValidationError{Code: ValidationErrorIssuerNotFound, HTTPStatus: http.StatusUnauthorized}
+
+	tests := []struct {
+		err    error
+		code   ValidationErrorCode
+		status int
+	}{
+		{&jwtError{Kind: jwtErrorMalformed}, ValidationErrorJwtValidationFailure, http.StatusBadRequest},
+		{&jwtError{Kind: jwtErrorUnsupportedAlgorithm}, ValidationErrorInvalidSigningAlgorithm, http.StatusUnauthorized},
+		{&jwtError{Kind: jwtErrorUnverifiable, Err: ke}, ValidationErrorJwtValidationFailure, http.StatusUnauthorized},
+		{&jwtError{Kind: jwtErrorUnverifiable, Err: ve}, ValidationErrorIssuerNotFound, http.StatusUnauthorized},
+		{&jwtError{Kind: jwtErrorSignatureInvalid}, ValidationErrorJwtValidationFailure, http.StatusUnauthorized},
+		{&jwtError{}, ValidationErrorJwtValidationUnknownFailure, http.StatusInternalServerError},
+		{errors.New("unknown"), ValidationErrorJwtValidationUnknownFailure, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		expectValidationError(t, jwtErrorToOpenIDError(tt.err), tt.code, tt.status, nil)
+	}
+
+	assert.Equal(t, ve, jwtErrorToOpenIDError(&jwtError{Kind: jwtErrorUnverifiable, Err: ve}))
+}
+
+func Test_defaultPemToPublicKeyParser_parse(t *testing.T) {
+	k := generateRSAKey(t)
+	pem, err := (&pemPublicKeyEncoder{}).encode(&k.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pk, err := (&defaultPemToPublicKeyParser{}).parse(pem)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &k.PublicKey, pk)
+
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pem, err = (&pemPublicKeyEncoder{}).encode(&ek.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pk, err = (&defaultPemToPublicKeyParser{}).parse(pem)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &ek.PublicKey, pk)
+
+	_, err = (&defaultPemToPublicKeyParser{}).parse([]byte("not a pem"))
+	assert.Error(t, err)
+}
+
+func expectJwtError(t *testing.T, err error, kind jwtErrorKind) {
+	jerr, ok := err.(*jwtError)
+	if !ok {
+		t.Fatalf("Expected error type '*jwtError' but was %T", err)
+	}
+
+	if jerr.Kind != kind {
+		t.Error("Expected error kind", kind, "but was", jerr.Kind, jerr)
+	}
+}
+
+func signToken(t *testing.T, alg jose.SignatureAlgorithm, key interface{}, payload string) string {
+	s, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, (&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := s.Sign([]byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := obj.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return raw
+}
@@ -2,8 +2,7 @@ package openid
 
 import (
 	"net/http"
-
-	"github.com/dgrijalva/jwt-go"
+	"time"
 )
 
 // The Configuration contains the entities needed to perform ID token validation.
@@ -12,6 +11,19 @@ type Configuration struct {
 	tokenValidator jwtTokenValidator
 	idTokenGetter  GetIDTokenFunc
 	errorHandler   ErrorHandlerFunc
+	provGetter     GetProvidersFunc
+
+	clock                func() time.Time
+	leeway               time.Duration
+	tokenAgePolicy       *TokenAgePolicy
+	customHTTPGetter     bool
+	retryPolicy          *RetryPolicy
+	jwksURIPolicy        *JwksURIPolicy
+	circuitBreakerPolicy *CircuitBreakerPolicy
+	circuitBreaker       *circuitBreakerKeySetProvider
+	policies             []*Policy
+	introspectionPolicy  *IntrospectionPolicy
+	decryptionPolicy     *DecryptionPolicy
 }
 
 type option func(*Configuration) error
@@ -26,7 +38,8 @@ func NewConfiguration(options ...option) (*Configuration, error) {
 	jp := newHTTPJwksProvider(defaultHTTPGet, &jsonJwksDecoder{})
 	ksp := newSigningKeySetProvider(cp, jp, &pemPublicKeyEncoder{})
 	kp := newSigningKeyProvider(ksp)
-	m.tokenValidator = newIDTokenValidator(nil, jwtParserFunc(jwt.Parse), kp, &defaultPemToRSAPublicKeyParser{})
+	// The time based claims are validated by the idTokenValidator, which supports leeway.
+	m.tokenValidator = newIDTokenValidator(nil, jwtParserFunc(parseJWT), kp, &defaultPemToPublicKeyParser{})
 
 	for _, option := range options {
 		err := option(m)
@@ -36,6 +49,41 @@ func NewConfiguration(options ...option) (*Configuration, error) {
 		}
 	}
 
+	if m.clock == nil {
+		m.clock = time.Now
+	}
+
+	tv := m.tokenValidator.(*idTokenValidator)
+	tv.now = m.clock
+	tv.leeway = m.leeway
+	tv.tokenAge = m.tokenAgePolicy
+
+	if m.jwksURIPolicy != nil {
+		ksp.jwksValidator = newJwksURIValidator(*m.jwksURIPolicy)
+		if !m.customHTTPGetter {
+			jp.getter = HTTPGetFunc(ksp.jwksValidator.httpGet)
+		}
+	}
+
+	if m.retryPolicy != nil {
+		cp.getter = newRetryHTTPGetter(cp.getter, *m.retryPolicy)
+		jp.getter = newRetryHTTPGetter(jp.getter, *m.retryPolicy)
+	}
+
+	if m.circuitBreakerPolicy != nil {
+		m.circuitBreaker = newCircuitBreakerKeySetProvider(ksp, *m.circuitBreakerPolicy)
+		kp.keySetGetter = m.circuitBreaker
+	}
+
+	if m.decryptionPolicy != nil {
+		m.tokenValidator = newDecryptingTokenValidator(m.tokenValidator, *m.decryptionPolicy)
+	}
+
+	if m.introspectionPolicy != nil {
+		cg := &providerConfigurationGetter{ksp: ksp, cb: m.circuitBreaker}
+		m.tokenValidator = newIntrospectionTokenValidator(m.tokenValidator, tv, cg, *m.introspectionPolicy)
+	}
+
 	return m, nil
 }
 
@@ -43,7 +91,11 @@ func NewConfiguration(options ...option) (*Configuration, error) {
 // providers containing the valid issuer and client IDs used to validate the ID Token.
 func ProvidersGetter(pg GetProvidersFunc) func(*Configuration) error {
 	return func(c *Configuration) error {
+		c.provGetter = pg
 		c.tokenValidator.(*idTokenValidator).provGetter = pg
+		c.tokenValidator.(*idTokenValidator).
+			keyGetter.(*signingKeyProvider).
+			keySetGetter.(*signingKeySetProvider).provGetter = pg
 		return nil
 	}
 }
@@ -76,6 +128,7 @@ func HTTPGetter(hg HTTPGetFunc) func(*Configuration) error {
 			keySetGetter.(*signingKeySetProvider)
 		sksp.configGetter.(*httpConfigurationProvider).getter = hg
 		sksp.jwksGetter.(*httpJwksProvider).getter = hg
+		c.customHTTPGetter = true
 		return nil
 	}
 }
@@ -84,12 +137,22 @@ func HTTPGetter(hg HTTPGetFunc) func(*Configuration) error {
 // If an error happens, i.e.: expired token, the next handler may or may not executed depending on the
 // provided ErrorHandlerFunc option. The default behavior, determined by validationErrorToHTTPStatus,
 // stops the execution and returns Unauthorized.
-// If the validation is successful then the next handler(h) will be executed.
+// If the validation is successful then the next handler(h) will be executed with the authenticated
+// user and the raw token stored in the request context, see UserFromContext and RawTokenFromContext.
 func Authenticate(conf *Configuration, h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if _, halt := authenticate(conf, w, r); !halt {
-			h.ServeHTTP(w, r)
+		jt, halt := authenticate(conf, w, r)
+		if halt {
+			return
 		}
+
+		if jt != nil {
+			if u, err := newUser(jt); err == nil {
+				r = requestWithUser(r, u)
+			}
+		}
+
+		h.ServeHTTP(w, r)
 	})
 }
 
@@ -99,16 +162,24 @@ func Authenticate(conf *Configuration, h http.Handler) http.Handler {
 // provided ErrorHandlerFunc option. The default behavior, determined by validationErrorToHTTPStatus,
 // stops the execution and returns Unauthorized.
 // If the validation is successful then the next handler(h) will be executed and will
-// receive the authenticated user information.
+// receive the authenticated user information, also stored in the request context.
 func AuthenticateUser(conf *Configuration, h UserHandler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if u, halt := authenticateUser(conf, w, r); !halt {
-			h.ServeHTTPWithUser(u, w, r)
+			h.ServeHTTPWithUser(u, w, requestWithUser(r, u))
 		}
 	})
 }
 
-func authenticate(c *Configuration, rw http.ResponseWriter, req *http.Request) (t *jwt.Token, halt bool) {
+func (c *Configuration) getErrorHandler() ErrorHandlerFunc {
+	if c.errorHandler == nil {
+		return validationErrorToHTTPStatus
+	}
+
+	return c.errorHandler
+}
+
+func authenticate(c *Configuration, rw http.ResponseWriter, req *http.Request) (t *jwtToken, halt bool) {
 	var tg GetIDTokenFunc
 	if c.idTokenGetter == nil {
 		tg = getIDTokenAuthorizationHeader
@@ -116,12 +187,7 @@ func authenticate(c *Configuration, rw http.ResponseWriter, req *http.Request) (
 		tg = c.idTokenGetter
 	}
 
-	var eh ErrorHandlerFunc
-	if c.errorHandler == nil {
-		eh = validationErrorToHTTPStatus
-	} else {
-		eh = c.errorHandler
-	}
+	eh := c.getErrorHandler()
 
 	ts, err := tg(req)
 
@@ -129,24 +195,19 @@ func authenticate(c *Configuration, rw http.ResponseWriter, req *http.Request) (
 		return nil, eh(err, rw, req)
 	}
 
-	vt, err := c.tokenValidator.validate(req, ts)
+	vt, err := NewValidator(c).validate(req, ts)
 
-	if err != nil {
-		return nil, eh(err, rw, req)
+	if err != nil && eh(err, rw, req) {
+		return nil, true
 	}
 
 	return vt, false
 }
 
 func authenticateUser(c *Configuration, rw http.ResponseWriter, req *http.Request) (u *User, halt bool) {
-	var vt *jwt.Token
+	var vt *jwtToken
 
-	var eh ErrorHandlerFunc
-	if c.errorHandler == nil {
-		eh = validationErrorToHTTPStatus
-	} else {
-		eh = c.errorHandler
-	}
+	eh := c.getErrorHandler()
 
 	if t, halt := authenticate(c, rw, req); !halt {
 		vt = t
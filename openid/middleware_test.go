@@ -6,7 +6,6 @@ import (
 	"net/http/httptest"
 	"testing"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -62,9 +61,10 @@ func Test_authenticateUser_WhenValidateSucceeds(t *testing.T) {
 	iss := "https://issuer"
 	sub := "SUB1"
 
-	jt := jwt.New(jwt.SigningMethodRS256)
-	jt.Claims.(jwt.MapClaims)["iss"] = iss
-	jt.Claims.(jwt.MapClaims)["sub"] = sub
+	jt := createTokenWithClaims(jwtClaims{})
+	jt.Claims["iss"] = iss
+	jt.Claims["sub"] = sub
+	jt.Claims["email"] = "user@issuer"
 
 	vm.On("validate", mock.Anything, idToken).Return(jt, nil)
 
@@ -86,8 +86,12 @@ func Test_authenticateUser_WhenValidateSucceeds(t *testing.T) {
 		t.Error("Expected user ID", sub, ", but got", u.ID)
 	}
 
-	if len(u.Claims) != len(jt.Claims.(jwt.MapClaims)) {
-		t.Error("Expected number of user claims", len(jt.Claims.(jwt.MapClaims)), ", but got", len(u.Claims))
+	if len(u.Claims) != len(jt.Claims) {
+		t.Error("Expected number of user claims", len(jt.Claims), ", but got", len(u.Claims))
+	}
+
+	if u.StandardClaims.Email != "user@issuer" {
+		t.Error("Expected user email user@issuer, but got", u.StandardClaims.Email)
 	}
 
 	vm.AssertExpectations(t)
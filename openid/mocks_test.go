@@ -7,10 +7,6 @@ import (
 
 	mock "github.com/stretchr/testify/mock"
 	jose "gopkg.in/square/go-jose.v2"
-
-	rsa "crypto/rsa"
-
-	jwt "github.com/dgrijalva/jwt-go"
 )
 
 // mockSigningKeyGetter is an autogenerated mock type for the signingKeyGetter type
@@ -113,15 +109,15 @@ type mockJwtTokenValidator struct {
 }
 
 // validate provides a mock function with given fields: r, t
-func (_m *mockJwtTokenValidator) validate(r *http.Request, t string) (*jwt.Token, error) {
+func (_m *mockJwtTokenValidator) validate(r *http.Request, t string) (*jwtToken, error) {
 	ret := _m.Called(r, t)
 
-	var r0 *jwt.Token
-	if rf, ok := ret.Get(0).(func(*http.Request, string) *jwt.Token); ok {
+	var r0 *jwtToken
+	if rf, ok := ret.Get(0).(func(*http.Request, string) *jwtToken); ok {
 		r0 = rf(r, t)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*jwt.Token)
+			r0 = ret.Get(0).(*jwtToken)
 		}
 	}
 
@@ -141,20 +137,20 @@ type mockJwtParser struct {
 }
 
 // parse provides a mock function with given fields: _a0, _a1
-func (_m *mockJwtParser) parse(_a0 string, _a1 jwt.Keyfunc) (*jwt.Token, error) {
+func (_m *mockJwtParser) parse(_a0 string, _a1 jwtKeyFunc) (*jwtToken, error) {
 	ret := _m.Called(_a0, _a1)
 
-	var r0 *jwt.Token
-	if rf, ok := ret.Get(0).(func(string, jwt.Keyfunc) *jwt.Token); ok {
+	var r0 *jwtToken
+	if rf, ok := ret.Get(0).(func(string, jwtKeyFunc) *jwtToken); ok {
 		r0 = rf(_a0, _a1)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*jwt.Token)
+			r0 = ret.Get(0).(*jwtToken)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string, jwt.Keyfunc) error); ok {
+	if rf, ok := ret.Get(1).(func(string, jwtKeyFunc) error); ok {
 		r1 = rf(_a0, _a1)
 	} else {
 		r1 = ret.Error(1)
@@ -298,22 +294,20 @@ func (_m *mockProvidersGetter) get() ([]Provider, error) {
 	return r0, r1
 }
 
-// mockPemToRSAPublicKeyParser is an autogenerated mock type for the pemToRSAPublicKeyParser type
-type mockPemToRSAPublicKeyParser struct {
+// mockPemToPublicKeyParser is an autogenerated mock type for the pemToPublicKeyParser type
+type mockPemToPublicKeyParser struct {
 	mock.Mock
 }
 
 // parse provides a mock function with given fields: key
-func (_m *mockPemToRSAPublicKeyParser) parse(key []byte) (*rsa.PublicKey, error) {
+func (_m *mockPemToPublicKeyParser) parse(key []byte) (interface{}, error) {
 	ret := _m.Called(key)
 
-	var r0 *rsa.PublicKey
-	if rf, ok := ret.Get(0).(func([]byte) *rsa.PublicKey); ok {
+	var r0 interface{}
+	if rf, ok := ret.Get(0).(func([]byte) interface{}); ok {
 		r0 = rf(key)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*rsa.PublicKey)
-		}
+		r0 = ret.Get(0)
 	}
 
 	var r1 error
@@ -0,0 +1,69 @@
+package openid
+
+import (
+	"net/http"
+)
+
+const nonceClaimName = "nonce"
+
+// The NonceVerifier verifies the 'nonce' claim of the ID Tokens against the value the
+// application associated with the authentication request, for instance stored in the
+// end-user's session.
+//
+// VerifyNonce receives the request being authenticated and the 'nonce' claim of the ID Token.
+// It returns an error if the nonce does not match the expected value. Errors of the type
+// *ValidationError are forwarded as they are to the ErrorHandlerFunc, other errors are wrapped
+// in a *ValidationError with the code ValidationErrorInvalidNonce.
+type NonceVerifier interface {
+	VerifyNonce(r *http.Request, nonce string) error
+}
+
+// The NonceVerifierFunc is an adapter to allow the use of functions as NonceVerifier.
+type NonceVerifierFunc func(r *http.Request, nonce string) error
+
+// VerifyNonce calls f(r, nonce)
+func (f NonceVerifierFunc) VerifyNonce(r *http.Request, nonce string) error {
+	return f(r, nonce)
+}
+
+// NonceVerification option registers the NonceVerifier used to verify the 'nonce' claim of the
+// ID Tokens. When this option is used tokens without a 'nonce' claim are rejected. When this
+// option is not used the 'nonce' claim is not verified.
+func NonceVerification(nv NonceVerifier) func(*Configuration) error {
+	return func(c *Configuration) error {
+		c.tokenValidator.(*idTokenValidator).nonceVerifier = nv
+		return nil
+	}
+}
+
+func (tv *idTokenValidator) validateNonce(r *http.Request, jt *jwtToken) error {
+	if tv.nonceVerifier == nil {
+		return nil
+	}
+
+	claims := jt.Claims
+	nonce, _ := claims[nonceClaimName].(string)
+
+	if nonce == "" {
+		return &ValidationError{
+			Code:       ValidationErrorNonceNotFound,
+			Message:    "The token 'nonce' claim was not found or was empty.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	if err := tv.nonceVerifier.VerifyNonce(r, nonce); err != nil {
+		if verr, ok := err.(*ValidationError); ok {
+			return verr
+		}
+
+		return &ValidationError{
+			Code:       ValidationErrorInvalidNonce,
+			Message:    "The token 'nonce' claim did not match the expected value.",
+			Err:        err,
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	return nil
+}
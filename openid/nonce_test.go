@@ -0,0 +1,83 @@
+package openid
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_validate_WhenNonceIsMissing(t *testing.T) {
+	_, jm, _, _, tv := createIDTokenValidator(t)
+	tv.nonceVerifier = NonceVerifierFunc(func(r *http.Request, nonce string) error {
+		t.Error("The nonce verifier should not have been called.")
+		return nil
+	})
+
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(createTokenWithClaims(jwtClaims{}), nil)
+
+	_, err := tv.validate(nil, mock.Anything)
+
+	expectValidationError(t, err, ValidationErrorNonceNotFound, http.StatusUnauthorized, nil)
+	jm.AssertExpectations(t)
+}
+
+func Test_validate_WhenNonceDoesNotMatch(t *testing.T) {
+	_, jm, _, _, tv := createIDTokenValidator(t)
+	ee := errors.New("nonce mismatch")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	tv.nonceVerifier = NonceVerifierFunc(func(r *http.Request, nonce string) error {
+		if r != req {
+			t.Error("The nonce verifier should have received the request.")
+		}
+
+		if nonce != "n-0S6_WzA2Mj" {
+			t.Error("Expected nonce n-0S6_WzA2Mj but got", nonce)
+		}
+
+		return ee
+	})
+
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(createTokenWithClaims(jwtClaims{"nonce": "n-0S6_WzA2Mj"}), nil)
+
+	_, err := tv.validate(req, mock.Anything)
+
+	expectValidationError(t, err, ValidationErrorInvalidNonce, http.StatusUnauthorized, ee)
+	jm.AssertExpectations(t)
+}
+
+func Test_validate_WhenNonceVerifierReturnsValidationError(t *testing.T) {
+	_, jm, _, _, tv := createIDTokenValidator(t)
+	ee := &ValidationError{Code: ValidationErrorInvalidNonce, HTTPStatus: http.StatusForbidden}
+	tv.nonceVerifier = NonceVerifierFunc(func(r *http.Request, nonce string) error { return ee })
+
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(createTokenWithClaims(jwtClaims{"nonce": "nonce"}), nil)
+
+	_, err := tv.validate(nil, mock.Anything)
+
+	expectValidationError(t, err, ee.Code, ee.HTTPStatus, nil)
+	jm.AssertExpectations(t)
+}
+
+func Test_validate_WhenNonceMatches(t *testing.T) {
+	_, jm, _, _, tv := createIDTokenValidator(t)
+	tv.nonceVerifier = NonceVerifierFunc(func(r *http.Request, nonce string) error { return nil })
+
+	jt := createTokenWithClaims(jwtClaims{"nonce": "nonce"})
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(jt, nil)
+
+	rjt, err := tv.validate(nil, mock.Anything)
+
+	if err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+
+	if rjt != jt {
+		t.Errorf("Expected %+v, but got %+v.", jt, rjt)
+	}
+
+	jm.AssertExpectations(t)
+}
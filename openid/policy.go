@@ -0,0 +1,625 @@
+package openid
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Policy represents a compiled authorization rule evaluated against the authenticated users.
+//
+// The rules are expressions combining the following elements:
+//
+//   - the values 'claims', the claims of the token, 'issuer' and 'subject', the Issuer and ID of the User;
+//   - the claims are accessed with dots or brackets, for instance claims.realm_access.roles or claims["https://example.com/tenant"];
+//   - the string, number, boolean and null literals and the arrays of literals, for instance ["a", "b"];
+//   - the operators ||, &&, !, ==, !=, <, <=, >, >= and in, with the usual precedence, and parenthesis.
+//
+// The operator 'in' tests whether the left value is an element of the right array or, when the
+// right value is a string, one of its space delimited fields, such as the 'scope' claim.
+// Claims not found in the token have the value null. For instance:
+//
+//	claims.email_verified == true && "admin" in claims.groups
+//	issuer == "https://accounts.google.com" && claims.hd in ["example.com", "example.org"]
+//	!("write" in claims.scope) || claims.acr == "mfa"
+//
+// A rule must evaluate to a boolean, the access is allowed when it evaluates to true.
+type Policy struct {
+	rule string
+	eval policyExpr
+}
+
+type policyExpr func(u *User) (interface{}, error)
+
+// CompilePolicy compiles the given rule into a Policy. It returns an error of the type
+// *SetupError with the code SetupErrorInvalidPolicy if the rule is not valid.
+func CompilePolicy(rule string) (*Policy, error) {
+	ts, err := tokenizePolicy(rule)
+	if err != nil {
+		return nil, invalidPolicyError(rule, err)
+	}
+
+	pp := &policyParser{tokens: ts}
+	e, err := pp.parseOr()
+	if err == nil && pp.peek().kind != policyTokenEnd {
+		err = fmt.Errorf("unexpected %q at position %d", pp.peek().text, pp.peek().pos)
+	}
+
+	if err != nil {
+		return nil, invalidPolicyError(rule, err)
+	}
+
+	return &Policy{rule: rule, eval: e}, nil
+}
+
+// MustCompilePolicy is like CompilePolicy but panics if the rule is not valid.
+func MustCompilePolicy(rule string) *Policy {
+	p, err := CompilePolicy(rule)
+	if err != nil {
+		panic(err)
+	}
+
+	return p
+}
+
+// String returns the rule the policy was compiled from.
+func (p *Policy) String() string {
+	return p.rule
+}
+
+// Evaluate evaluates the policy against the given user. It returns an error if the rule can not
+// be evaluated, for instance when comparing a string with a number.
+func (p *Policy) Evaluate(u *User) (bool, error) {
+	v, err := p.eval(u)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("the policy evaluated to %v instead of a boolean", v)
+	}
+
+	return b, nil
+}
+
+// AuthorizationPolicy option registers a rule, compiled with CompilePolicy, evaluated against
+// the users authenticated by all the middlewares using the Configuration. The option returns the
+// compilation error if the rule is not valid. It can be used multiple times, all the rules must
+// allow the access.
+func AuthorizationPolicy(rule string) func(*Configuration) error {
+	return func(c *Configuration) error {
+		p, err := CompilePolicy(rule)
+		if err != nil {
+			return err
+		}
+
+		c.policies = append(c.policies, p)
+		return nil
+	}
+}
+
+// AuthorizePolicy returns a middleware that evaluates the given policy against the User stored in
+// the request context before calling the next handler. It must be stacked after Authenticate,
+// AuthenticateUser or Middleware, the requests without a User are denied.
+// When the policy denies the access, or can not be evaluated, the error is handled by the
+// ErrorHandlerFunc as an *AuthorizationError with the code AuthorizationErrorPolicyDenied.
+// The default behavior stops the execution and returns Forbidden.
+func AuthorizePolicy(conf *Configuration, p *Policy) func(http.Handler) http.Handler {
+	return userMiddleware(conf, func(u *User, r *http.Request) error {
+		return authorizePolicies(u, p)
+	})
+}
+
+// authorizePolicies returns an error if any of the policies does not allow the access.
+func authorizePolicies(u *User, ps ...*Policy) error {
+	for _, p := range ps {
+		var allowed bool
+		var err error
+		if u != nil {
+			allowed, err = p.Evaluate(u)
+		}
+
+		// The rules are not part of the message sent to the client.
+		if err != nil {
+			return &AuthorizationError{
+				Code:       AuthorizationErrorPolicyDenied,
+				Message:    "The access could not be authorized.",
+				Err:        fmt.Errorf("the policy %q could not be evaluated: %v", p.rule, err),
+				HTTPStatus: http.StatusForbidden,
+			}
+		}
+
+		if !allowed {
+			return &AuthorizationError{
+				Code:       AuthorizationErrorPolicyDenied,
+				Message:    "The access was denied by the authorization policies.",
+				Err:        fmt.Errorf("the policy %q denied the access", p.rule),
+				HTTPStatus: http.StatusForbidden,
+			}
+		}
+	}
+
+	return nil
+}
+
+func invalidPolicyError(rule string, err error) error {
+	return &SetupError{
+		Code:    SetupErrorInvalidPolicy,
+		Message: fmt.Sprintf("The policy %q is not valid: %v.", rule, err),
+		Err:     err,
+	}
+}
+
+type policyTokenKind int
+
+const (
+	policyTokenEnd policyTokenKind = iota
+	policyTokenIdent
+	policyTokenString
+	policyTokenNumber
+	policyTokenOperator
+)
+
+type policyToken struct {
+	kind policyTokenKind
+	text string
+	pos  int
+}
+
+var policyOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ",", "."}
+
+func tokenizePolicy(rule string) ([]policyToken, error) {
+	var ts []policyToken
+	rs := []rune(rule)
+
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"':
+			j := i + 1
+			for ; j < len(rs) && rs[j] != '"'; j++ {
+				if rs[j] == '\\' {
+					j++
+				}
+			}
+
+			if j >= len(rs) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+
+			s, err := strconv.Unquote(string(rs[i : j+1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d", i)
+			}
+
+			ts = append(ts, policyToken{policyTokenString, s, i})
+			i = j + 1
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(rs) && unicode.IsDigit(rs[i+1])):
+			j := i + 1
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || rs[j] == '.') {
+				j++
+			}
+
+			ts = append(ts, policyToken{policyTokenNumber, string(rs[i:j]), i})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i + 1
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_' || rs[j] == '-') {
+				j++
+			}
+
+			ts = append(ts, policyToken{policyTokenIdent, string(rs[i:j]), i})
+			i = j
+		default:
+			op := ""
+			for _, o := range policyOperators {
+				if strings.HasPrefix(string(rs[i:]), o) {
+					op = o
+					break
+				}
+			}
+
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+			}
+
+			ts = append(ts, policyToken{policyTokenOperator, op, i})
+			i += len(op)
+		}
+	}
+
+	return append(ts, policyToken{kind: policyTokenEnd, pos: len(rs)}), nil
+}
+
+type policyParser struct {
+	tokens []policyToken
+	pos    int
+}
+
+func (pp *policyParser) peek() policyToken {
+	return pp.tokens[pp.pos]
+}
+
+func (pp *policyParser) next() policyToken {
+	t := pp.tokens[pp.pos]
+	if t.kind != policyTokenEnd {
+		pp.pos++
+	}
+
+	return t
+}
+
+func (pp *policyParser) accept(op string) bool {
+	if t := pp.peek(); t.kind == policyTokenOperator && t.text == op {
+		pp.pos++
+		return true
+	}
+
+	return false
+}
+
+func (pp *policyParser) expect(op string) error {
+	if !pp.accept(op) {
+		t := pp.peek()
+		return fmt.Errorf("expected %q at position %d", op, t.pos)
+	}
+
+	return nil
+}
+
+func (pp *policyParser) parseOr() (policyExpr, error) {
+	left, err := pp.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for pp.accept("||") {
+		right, err := pp.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = logicalExpr(left, right, true)
+	}
+
+	return left, nil
+}
+
+func (pp *policyParser) parseAnd() (policyExpr, error) {
+	left, err := pp.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+
+	for pp.accept("&&") {
+		right, err := pp.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+
+		left = logicalExpr(left, right, false)
+	}
+
+	return left, nil
+}
+
+func (pp *policyParser) parseComparison() (policyExpr, error) {
+	left, err := pp.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	t := pp.peek()
+	op := t.text
+	switch {
+	case t.kind == policyTokenOperator && (op == "==" || op == "!=" || op == "<" || op == "<=" || op == ">" || op == ">="):
+	case t.kind == policyTokenIdent && op == "in":
+	default:
+		return left, nil
+	}
+
+	pp.next()
+	right, err := pp.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	return comparisonExpr(op, left, right), nil
+}
+
+func (pp *policyParser) parseUnary() (policyExpr, error) {
+	if pp.accept("!") {
+		e, err := pp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return func(u *User) (interface{}, error) {
+			v, err := e(u)
+			if err != nil {
+				return nil, err
+			}
+
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("the operator ! expects a boolean, got %v", v)
+			}
+
+			return !b, nil
+		}, nil
+	}
+
+	return pp.parsePrimary()
+}
+
+func (pp *policyParser) parsePrimary() (policyExpr, error) {
+	t := pp.next()
+	switch t.kind {
+	case policyTokenString:
+		return constantExpr(t.text), nil
+	case policyTokenNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", t.text, t.pos)
+		}
+
+		return constantExpr(f), nil
+	case policyTokenIdent:
+		switch t.text {
+		case "true":
+			return constantExpr(true), nil
+		case "false":
+			return constantExpr(false), nil
+		case "null":
+			return constantExpr(nil), nil
+		case "issuer":
+			return func(u *User) (interface{}, error) { return u.Issuer, nil }, nil
+		case "subject":
+			return func(u *User) (interface{}, error) { return u.ID, nil }, nil
+		case "claims":
+			return pp.parseClaimPath()
+		}
+	case policyTokenOperator:
+		switch t.text {
+		case "(":
+			e, err := pp.parseOr()
+			if err != nil {
+				return nil, err
+			}
+
+			return e, pp.expect(")")
+		case "[":
+			return pp.parseArray()
+		}
+	case policyTokenEnd:
+		return nil, fmt.Errorf("unexpected end of the policy")
+	}
+
+	return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+func (pp *policyParser) parseClaimPath() (policyExpr, error) {
+	var path []string
+	for {
+		if pp.accept(".") {
+			t := pp.next()
+			if t.kind != policyTokenIdent {
+				return nil, fmt.Errorf("expected a claim name at position %d", t.pos)
+			}
+
+			path = append(path, t.text)
+		} else if pp.accept("[") {
+			t := pp.next()
+			if t.kind != policyTokenString {
+				return nil, fmt.Errorf("expected a claim name string at position %d", t.pos)
+			}
+
+			path = append(path, t.text)
+			if err := pp.expect("]"); err != nil {
+				return nil, err
+			}
+		} else {
+			break
+		}
+	}
+
+	return func(u *User) (interface{}, error) {
+		var v interface{} = u.Claims
+		for _, name := range path {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, nil
+			}
+
+			v = m[name]
+		}
+
+		return normalizePolicyValue(v), nil
+	}, nil
+}
+
+func (pp *policyParser) parseArray() (policyExpr, error) {
+	var es []policyExpr
+	if !pp.accept("]") {
+		for {
+			e, err := pp.parseOr()
+			if err != nil {
+				return nil, err
+			}
+
+			es = append(es, e)
+			if pp.accept("]") {
+				break
+			}
+
+			if err := pp.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return func(u *User) (interface{}, error) {
+		vs := make([]interface{}, len(es))
+		for i, e := range es {
+			v, err := e(u)
+			if err != nil {
+				return nil, err
+			}
+
+			vs[i] = v
+		}
+
+		return vs, nil
+	}, nil
+}
+
+func constantExpr(v interface{}) policyExpr {
+	return func(*User) (interface{}, error) { return v, nil }
+}
+
+func logicalExpr(left policyExpr, right policyExpr, or bool) policyExpr {
+	op := "&&"
+	if or {
+		op = "||"
+	}
+
+	operand := func(e policyExpr, u *User) (bool, error) {
+		v, err := e(u)
+		if err != nil {
+			return false, err
+		}
+
+		b, ok := v.(bool)
+		if !ok {
+			return false, fmt.Errorf("the operator %v expects booleans, got %v", op, v)
+		}
+
+		return b, nil
+	}
+
+	return func(u *User) (interface{}, error) {
+		l, err := operand(left, u)
+		if err != nil {
+			return nil, err
+		}
+
+		if l == or {
+			return l, nil
+		}
+
+		return operand(right, u)
+	}
+}
+
+func comparisonExpr(op string, left policyExpr, right policyExpr) policyExpr {
+	return func(u *User) (interface{}, error) {
+		l, err := left(u)
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := right(u)
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case "==":
+			return reflect.DeepEqual(l, r), nil
+		case "!=":
+			return !reflect.DeepEqual(l, r), nil
+		case "in":
+			return policyContains(r, l), nil
+		}
+
+		return policyCompare(op, l, r)
+	}
+}
+
+func policyContains(collection interface{}, v interface{}) bool {
+	switch c := collection.(type) {
+	case []interface{}:
+		for _, e := range c {
+			if reflect.DeepEqual(e, v) {
+				return true
+			}
+		}
+	case string:
+		if s, ok := v.(string); ok {
+			for _, f := range strings.Fields(c) {
+				if f == s {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func policyCompare(op string, l interface{}, r interface{}) (interface{}, error) {
+	var c int
+	switch lv := l.(type) {
+	case float64:
+		rv, ok := r.(float64)
+		if !ok {
+			return nil, fmt.Errorf("the operator %v can not compare %v and %v", op, l, r)
+		}
+
+		if lv < rv {
+			c = -1
+		} else if lv > rv {
+			c = 1
+		}
+	case string:
+		rv, ok := r.(string)
+		if !ok {
+			return nil, fmt.Errorf("the operator %v can not compare %v and %v", op, l, r)
+		}
+
+		c = strings.Compare(lv, rv)
+	default:
+		return nil, fmt.Errorf("the operator %v can not compare %v and %v", op, l, r)
+	}
+
+	switch op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	}
+
+	return c >= 0, nil
+}
+
+// normalizePolicyValue converts the numbers found in the claims to float64, the type of the
+// number literals, so they can be compared.
+func normalizePolicyValue(v interface{}) interface{} {
+	switch n := v.(type) {
+	case json.Number:
+		if f, err := n.Float64(); err == nil {
+			return f
+		}
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case []interface{}:
+		vs := make([]interface{}, len(n))
+		for i, e := range n {
+			vs[i] = normalizePolicyValue(e)
+		}
+		return vs
+	}
+
+	return v
+}
@@ -0,0 +1,150 @@
+package openid
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_Policy_Evaluate(t *testing.T) {
+	u := &User{Issuer: "https://issuer", ID: "SUB1", Claims: map[string]interface{}{
+		"email_verified":             true,
+		"groups":                     []interface{}{"admin", "users"},
+		"scope":                      "read write",
+		"hd":                         "example.com",
+		"level":                      json.Number("3"),
+		"age":                        42.0,
+		"realm_access":               map[string]interface{}{"roles": []interface{}{"editor"}},
+		"https://example.com/tenant": "t1",
+	}}
+
+	for rule, expected := range map[string]bool{
+		`claims.email_verified == true && "admin" in claims.groups`:                      true,
+		`claims.email_verified == true && "owner" in claims.groups`:                      false,
+		`"owner" in claims.groups || "users" in claims.groups`:                           true,
+		`"write" in claims.scope && !("delete" in claims.scope)`:                         true,
+		`claims.hd in ["example.com", "example.org"]`:                                    true,
+		`issuer == "https://issuer" && subject != "SUB2"`:                                true,
+		`claims.level >= 3 && claims.level < 4 && claims.age > 41.5 && claims.age <= 42`: true,
+		`"editor" in claims.realm_access.roles`:                                          true,
+		`claims["https://example.com/tenant"] == "t1"`:                                   true,
+		`claims.missing == null && claims.hd.name == null`:                               true,
+		`claims.groups == ["admin", "users"]`:                                            true,
+		`true || claims.age > "x"`:                                                       true,
+		`false && claims.age > "x"`:                                                      false,
+		`!(claims.hd < "f")`:                                                             false,
+	} {
+		p, err := CompilePolicy(rule)
+		if err != nil {
+			t.Error("An error was returned but not expected for", rule, err)
+			continue
+		}
+
+		allowed, err := p.Evaluate(u)
+		if err != nil {
+			t.Error("An error was returned but not expected for", rule, err)
+		}
+
+		if allowed != expected {
+			t.Errorf("Expected %v for %v, but got %v.", expected, rule, allowed)
+		}
+	}
+}
+
+func Test_Policy_Evaluate_WhenRuleCanNotBeEvaluated(t *testing.T) {
+	u := &User{Claims: map[string]interface{}{"age": 42.0, "name": "user"}}
+
+	for _, rule := range []string{
+		`claims.age > "x"`,
+		`claims.name && true`,
+		`!claims.name`,
+		`claims.name`,
+		`claims.missing < 1`,
+	} {
+		if _, err := MustCompilePolicy(rule).Evaluate(u); err == nil {
+			t.Error("An error was expected but not returned for", rule)
+		}
+	}
+}
+
+func Test_CompilePolicy_WhenRuleIsInvalid(t *testing.T) {
+	for _, rule := range []string{
+		``,
+		`claims.`,
+		`claims[1]`,
+		`"unterminated`,
+		`(true`,
+		`true true`,
+		`unknown == 1`,
+		`claims.a == `,
+		`[1, 2`,
+		`claims.a # 1`,
+		`1.2.3 == 1`,
+	} {
+		_, err := CompilePolicy(rule)
+
+		expectSetupError(t, err, SetupErrorInvalidPolicy)
+	}
+}
+
+func Test_AuthorizationPolicy_WhenRuleIsInvalid(t *testing.T) {
+	_, err := NewConfiguration(AuthorizationPolicy(`claims.a ==`))
+
+	expectSetupError(t, err, SetupErrorInvalidPolicy)
+}
+
+func Test_authenticate_WhenConfigurationPolicyDenies(t *testing.T) {
+	vm, c := createConfiguration(t, nil, getIDTokenReturnsSuccess)
+	c.policies = []*Policy{MustCompilePolicy(`claims.email_verified == true`)}
+
+	jt := createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "SUB1", "email_verified": false})
+
+	vm.On("validate", mock.Anything, idToken).Return(jt, nil)
+
+	h := Authenticate(c, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("The handler should not have been called.")
+	}))
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+	vm.AssertExpectations(t)
+}
+
+func Test_AuthorizePolicy(t *testing.T) {
+	var herr error
+	vm, c := createConfiguration(t, func(e error, w http.ResponseWriter, r *http.Request) bool {
+		herr = e
+		return true
+	}, getIDTokenReturnsSuccess)
+
+	jt := createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "SUB1", "groups": []interface{}{"users"}})
+
+	vm.On("validate", mock.Anything, idToken).Return(jt, nil)
+
+	called := false
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	Middleware(c)(AuthorizePolicy(c, MustCompilePolicy(`"users" in claims.groups`))(h)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !called || herr != nil {
+		t.Error("The handler should have been called without error.", herr)
+	}
+
+	called = false
+	Middleware(c)(AuthorizePolicy(c, MustCompilePolicy(`"admin" in claims.groups`))(h)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if called {
+		t.Error("The handler should not have been called.")
+	}
+
+	expectAuthorizationError(t, herr, AuthorizationErrorPolicyDenied)
+	assert.NotContains(t, herr.(*AuthorizationError).Message, "admin", "The rule should not be part of the message.")
+	assert.Contains(t, herr.(*AuthorizationError).Err.Error(), "in claims.groups")
+	vm.AssertExpectations(t)
+}
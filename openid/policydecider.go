@@ -0,0 +1,249 @@
+package openid
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// PolicyInput is the document describing an authenticated request submitted to a PolicyDecider.
+// Its JSON encoding is stable and can be relied upon by external policy engines.
+//
+// The Headers contains the allowlisted headers of the request, indexed by their lowercased names.
+// Multiple values of the same header are joined with commas.
+type PolicyInput struct {
+	Method  string                 `json:"method"`
+	Path    string                 `json:"path"`
+	Headers map[string]string      `json:"headers"`
+	Issuer  string                 `json:"issuer"`
+	Subject string                 `json:"subject"`
+	Claims  map[string]interface{} `json:"claims"`
+}
+
+// PolicyDecision is the decision made by a PolicyDecider. The Reasons explain the decision, when
+// the access is denied they are returned as the Err of the *AuthorizationError given to the
+// ErrorHandlerFunc, they are not part of its Message.
+type PolicyDecision struct {
+	Allow   bool     `json:"allow"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// The PolicyDecider decides whether authenticated requests are allowed, for instance by
+// delegating the decision to an external policy engine.
+//
+// Decide returns an error if no decision could be made, in which case the access is denied.
+type PolicyDecider interface {
+	Decide(ctx context.Context, in *PolicyInput) (*PolicyDecision, error)
+}
+
+// The PolicyDeciderFunc is an adapter to allow the use of functions as PolicyDecider.
+type PolicyDeciderFunc func(ctx context.Context, in *PolicyInput) (*PolicyDecision, error)
+
+// Decide calls f(ctx, in)
+func (f PolicyDeciderFunc) Decide(ctx context.Context, in *PolicyInput) (*PolicyDecision, error) {
+	return f(ctx, in)
+}
+
+// AuthorizeDecision returns a middleware that submits the request and the User stored in its
+// context to the given PolicyDecider before calling the next handler. Only the given headers are
+// included in the PolicyInput. It must be stacked after Authenticate, AuthenticateUser or
+// Middleware, the requests without a User are denied without being submitted.
+// When the access is denied the error is handled by the ErrorHandlerFunc as an *AuthorizationError
+// with the code AuthorizationErrorDecisionDenied, the default behavior stops the execution and
+// returns Forbidden. When the decider fails the code is AuthorizationErrorDecisionFailure and
+// the default behavior returns Internal Server Error.
+func AuthorizeDecision(conf *Configuration, pd PolicyDecider, headers []string) func(http.Handler) http.Handler {
+	return userMiddleware(conf, func(u *User, r *http.Request) error {
+		if u == nil {
+			return &AuthorizationError{
+				Code:       AuthorizationErrorDecisionDenied,
+				Message:    "The request does not carry an authenticated user.",
+				HTTPStatus: http.StatusForbidden,
+			}
+		}
+
+		return decide(r.Context(), pd, NewPolicyInput(u, r, headers))
+	})
+}
+
+// NewPolicyInput returns the PolicyInput describing the request made by the given user,
+// including only the given headers.
+func NewPolicyInput(u *User, r *http.Request, headers []string) *PolicyInput {
+	in := &PolicyInput{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Headers: make(map[string]string),
+		Claims:  make(map[string]interface{}),
+	}
+
+	for _, name := range headers {
+		if vs := r.Header[http.CanonicalHeaderKey(name)]; len(vs) > 0 {
+			in.Headers[strings.ToLower(name)] = strings.Join(vs, ",")
+		}
+	}
+
+	if u != nil {
+		in.Issuer = u.Issuer
+		in.Subject = u.ID
+		if u.Claims != nil {
+			in.Claims = u.Claims
+		}
+	}
+
+	return in
+}
+
+func decide(ctx context.Context, pd PolicyDecider, in *PolicyInput) error {
+	d, err := pd.Decide(ctx, in)
+	if err != nil {
+		return &AuthorizationError{
+			Code:       AuthorizationErrorDecisionFailure,
+			Message:    "The policy decision could not be made.",
+			Err:        err,
+			HTTPStatus: http.StatusInternalServerError,
+		}
+	}
+
+	if d == nil || !d.Allow {
+		// The reasons may describe the policies, they are not part of the message sent to the client.
+		var reasons error
+		if d != nil && len(d.Reasons) > 0 {
+			reasons = errors.New(strings.Join(d.Reasons, "; "))
+		}
+
+		return &AuthorizationError{
+			Code:       AuthorizationErrorDecisionDenied,
+			Message:    "The policy decider denied the access.",
+			Err:        reasons,
+			HTTPStatus: http.StatusForbidden,
+		}
+	}
+
+	return nil
+}
+
+// PolicyRule associates a Policy with the requests it applies to.
+//
+// The Method, when not empty, is the HTTP method of the requests the rule applies to.
+//
+// The PathPrefix, when not empty, is the prefix of the path of the requests the rule applies to.
+type PolicyRule struct {
+	Method     string
+	PathPrefix string
+	Policy     *Policy
+}
+
+// LocalPolicyDecider is the in-process PolicyDecider evaluating the policies of the rules
+// applying to the requests. The access is allowed when at least one rule applies to the request
+// and all of those rules allow it.
+type LocalPolicyDecider struct {
+	Rules []PolicyRule
+}
+
+// Decide evaluates the rules applying to the request described by the input.
+func (d *LocalPolicyDecider) Decide(ctx context.Context, in *PolicyInput) (*PolicyDecision, error) {
+	u := &User{Issuer: in.Issuer, ID: in.Subject, Claims: in.Claims}
+	pd := &PolicyDecision{Allow: true}
+	matched := false
+
+	for _, r := range d.Rules {
+		if (r.Method != "" && !strings.EqualFold(r.Method, in.Method)) || !strings.HasPrefix(in.Path, r.PathPrefix) {
+			continue
+		}
+
+		matched = true
+		allowed, err := r.Policy.Evaluate(u)
+		if err != nil {
+			return nil, err
+		}
+
+		if !allowed {
+			pd.Allow = false
+			pd.Reasons = append(pd.Reasons, fmt.Sprintf("the policy %q denied the access", r.Policy))
+		}
+	}
+
+	if !matched {
+		return &PolicyDecision{Reasons: []string{fmt.Sprintf("no rule applies to %v %v", in.Method, in.Path)}}, nil
+	}
+
+	return pd, nil
+}
+
+// HTTPPolicyDecider is the PolicyDecider delegating the decisions to a policy engine exposing
+// an HTTP API in the style of the Open Policy Agent data API. The PolicyInput is posted to the
+// URL as the 'input' member of a JSON document and the engine responds with a JSON document
+// containing the PolicyDecision as its 'result' member, for instance:
+//
+//	request:  {"input": {"method": "GET", "path": "/", ...}}
+//	response: {"result": {"allow": false, "reasons": ["not an admin"]}}
+//
+// A boolean 'result' is also accepted and a document without 'result', the undefined decision of
+// the Open Policy Agent, denies the access. When the Client is nil http.DefaultClient is used.
+type HTTPPolicyDecider struct {
+	URL    string
+	Client *http.Client
+}
+
+// Decide posts the input to the policy engine and returns its decision.
+func (d *HTTPPolicyDecider) Decide(ctx context.Context, in *PolicyInput) (*PolicyDecision, error) {
+	body, err := json.Marshal(struct {
+		Input *PolicyInput `json:"input"`
+	}{in})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	c := d.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the policy engine %v responded with the status %v", d.URL, resp.Status)
+	}
+
+	var out struct {
+		Result json.RawMessage `json:"result"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+
+	// An undefined decision, i.e.: a document without result, denies the access.
+	if len(out.Result) == 0 {
+		return &PolicyDecision{Reasons: []string{"the policy engine returned an undefined decision"}}, nil
+	}
+
+	var allow bool
+	if err := json.Unmarshal(out.Result, &allow); err == nil {
+		return &PolicyDecision{Allow: allow}, nil
+	}
+
+	pd := new(PolicyDecision)
+	if err := json.Unmarshal(out.Result, pd); err != nil {
+		return nil, fmt.Errorf("the policy engine %v responded with an invalid result: %v", d.URL, err)
+	}
+
+	return pd, nil
+}
@@ -0,0 +1,173 @@
+package openid
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_NewPolicyInput(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPut, "/orders/1?x=1", nil)
+	r.Header.Add("X-Tenant", "t1")
+	r.Header.Add("X-Tenant", "t2")
+	r.Header.Set("Authorization", "Bearer token")
+	u := &User{Issuer: "https://issuer", ID: "SUB1", Claims: map[string]interface{}{"roles": []interface{}{"admin"}}}
+
+	in := NewPolicyInput(u, r, []string{"x-tenant", "X-Missing"})
+
+	b, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal("An error was returned but not expected.", err)
+	}
+
+	assert.JSONEq(t, `{
+		"method": "PUT",
+		"path": "/orders/1",
+		"headers": {"x-tenant": "t1,t2"},
+		"issuer": "https://issuer",
+		"subject": "SUB1",
+		"claims": {"roles": ["admin"]}
+	}`, string(b))
+}
+
+func Test_LocalPolicyDecider_Decide(t *testing.T) {
+	d := &LocalPolicyDecider{Rules: []PolicyRule{
+		{PathPrefix: "/", Policy: MustCompilePolicy(`claims.email_verified == true`)},
+		{Method: "DELETE", PathPrefix: "/orders", Policy: MustCompilePolicy(`"admin" in claims.roles`)},
+	}}
+
+	claims := map[string]interface{}{"email_verified": true, "roles": []interface{}{"user"}}
+
+	pd, err := d.Decide(context.Background(), &PolicyInput{Method: "GET", Path: "/orders/1", Claims: claims})
+	assert.Nil(t, err)
+	assert.True(t, pd.Allow)
+
+	pd, err = d.Decide(context.Background(), &PolicyInput{Method: "delete", Path: "/orders/1", Claims: claims})
+	assert.Nil(t, err)
+	assert.False(t, pd.Allow)
+	assert.Len(t, pd.Reasons, 1)
+
+	pd, err = (&LocalPolicyDecider{}).Decide(context.Background(), &PolicyInput{Method: "GET", Path: "/"})
+	assert.Nil(t, err)
+	assert.False(t, pd.Allow)
+}
+
+func Test_HTTPPolicyDecider_Decide(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+
+		switch r.URL.Path {
+		case "/v1/data/allow":
+			w.Write([]byte(`{"result": true}`))
+		case "/v1/data/decision":
+			w.Write([]byte(`{"result": {"allow": false, "reasons": ["not an admin"]}}`))
+		case "/v1/data/undefined":
+			w.Write([]byte(`{}`))
+		case "/v1/data/invalid":
+			w.Write([]byte(`{"result": "yes"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	in := &PolicyInput{Method: "GET", Path: "/", Subject: "SUB1"}
+
+	pd, err := (&HTTPPolicyDecider{URL: server.URL + "/v1/data/allow"}).Decide(context.Background(), in)
+	assert.Nil(t, err)
+	assert.Equal(t, &PolicyDecision{Allow: true}, pd)
+	assert.Equal(t, "SUB1", received["input"].(map[string]interface{})["subject"])
+
+	pd, err = (&HTTPPolicyDecider{URL: server.URL + "/v1/data/decision", Client: server.Client()}).Decide(context.Background(), in)
+	assert.Nil(t, err)
+	assert.Equal(t, &PolicyDecision{Allow: false, Reasons: []string{"not an admin"}}, pd)
+
+	pd, err = (&HTTPPolicyDecider{URL: server.URL + "/v1/data/undefined"}).Decide(context.Background(), in)
+	assert.Nil(t, err)
+	assert.False(t, pd.Allow)
+
+	_, err = (&HTTPPolicyDecider{URL: server.URL + "/v1/data/invalid"}).Decide(context.Background(), in)
+	assert.NotNil(t, err)
+
+	_, err = (&HTTPPolicyDecider{URL: server.URL + "/v1/data/error"}).Decide(context.Background(), in)
+	assert.NotNil(t, err)
+}
+
+func Test_AuthorizeDecision(t *testing.T) {
+	var herr error
+	vm, c := createConfiguration(t, func(e error, w http.ResponseWriter, r *http.Request) bool {
+		herr = e
+		return true
+	}, getIDTokenReturnsSuccess)
+
+	jt := createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "SUB1"})
+
+	vm.On("validate", mock.Anything, idToken).Return(jt, nil)
+
+	called := false
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	allow := PolicyDeciderFunc(func(ctx context.Context, in *PolicyInput) (*PolicyDecision, error) {
+		assert.Equal(t, "SUB1", in.Subject)
+		assert.Equal(t, "t1", in.Headers["x-tenant"])
+		return &PolicyDecision{Allow: true}, nil
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Tenant", "t1")
+	Middleware(c)(AuthorizeDecision(c, allow, []string{"X-Tenant"})(h)).ServeHTTP(httptest.NewRecorder(), r)
+
+	if !called || herr != nil {
+		t.Error("The handler should have been called without error.", herr)
+	}
+
+	called = false
+	deny := PolicyDeciderFunc(func(ctx context.Context, in *PolicyInput) (*PolicyDecision, error) {
+		return &PolicyDecision{Reasons: []string{"not an admin"}}, nil
+	})
+
+	Middleware(c)(AuthorizeDecision(c, deny, nil)(h)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if called {
+		t.Error("The handler should not have been called.")
+	}
+
+	expectAuthorizationError(t, herr, AuthorizationErrorDecisionDenied)
+	assert.NotContains(t, herr.Error(), "not an admin")
+	assert.EqualError(t, herr.(*AuthorizationError).Err, "not an admin")
+
+	fail := PolicyDeciderFunc(func(ctx context.Context, in *PolicyInput) (*PolicyDecision, error) {
+		return nil, errors.New("unavailable")
+	})
+
+	Middleware(c)(AuthorizeDecision(c, fail, nil)(h)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if ae, ok := herr.(*AuthorizationError); !ok || ae.Code != AuthorizationErrorDecisionFailure || ae.HTTPStatus != http.StatusInternalServerError {
+		t.Errorf("Unexpected error %+v.", herr)
+	}
+
+	vm.AssertExpectations(t)
+}
+
+func Test_AuthorizeDecision_WhenUserIsNotInContext(t *testing.T) {
+	var herr error
+	_, c := createConfiguration(t, func(e error, w http.ResponseWriter, r *http.Request) bool {
+		herr = e
+		return true
+	}, nil)
+
+	pd := &LocalPolicyDecider{Rules: []PolicyRule{{PathPrefix: "/", Policy: MustCompilePolicy(`!("banned" in claims.groups)`)}}}
+
+	AuthorizeDecision(c, pd, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("The handler should not have been called.")
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	expectAuthorizationError(t, herr, AuthorizationErrorDecisionDenied)
+}
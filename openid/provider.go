@@ -1,5 +1,13 @@
 package openid
 
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
 // Provider represents an OpenId Identity Provider (OP) and contains
 // the information needed to perform validation of ID Token.
 // See OpenId terminology http://openid.net/specs/openid-connect-core-1_0.html#Terminology.
@@ -9,9 +17,52 @@ package openid
 //
 // The CliendIDs contains the list of client IDs registered with the OP that are meant to be accepted by the service using this package.
 // These values are used to validate the 'aud' clain present in the ID Token.
+//
+// The MetadataEndpoints optionally contains the base URLs from where the OP configuration can be retrieved,
+// i.e.: the same OP deployed in different regions. The path /.well-known/openid-configuration is appended to
+// each of them. The endpoints are tried in order until the configuration and the signing keys are retrieved,
+// starting from the last one that succeeded. When empty the Issuer is used. The configurations retrieved must
+// publish the Issuer as their issuer, otherwise they are rejected.
+//
+// The AllowedJwksHosts contains the hosts, in addition to the ones allowed by the JwksURIRestrictions option,
+// the jwks_uri published by the OP may point to. It is only used when that option is registered.
+//
+// The Leeway, when not nil, overrides the leeway registered with the Leeway option for the tokens
+// issued by this OP, including with zero. A negative Leeway is treated as zero.
+//
+// The TokenAge, when not nil, overrides the policy registered with the TokenAge option for the tokens
+// issued by this OP.
+//
+// The SigningAlgorithms contains the algorithms the ID Tokens issued by this OP may be signed with when
+// the StrictValidation option is used. When empty only RS256 is accepted.
+//
+// The Audiences contains the identifiers of the resources, such as https://api.example.com, accepted
+// in the 'aud' claim of the access tokens when the AccessTokenValidation option is used, instead of
+// the ClientIDs. A Provider must have at least one client id or one audience.
+//
+// The RolesClaims contains the paths of the claims holding the roles or groups of the end-user, used by
+// the RequireAnyRole and RequireAllRoles middlewares. The segments of a path are separated by dots, for
+// instance 'realm_access.roles' or 'resource_access.my-client.roles'. When empty the 'roles' claim is used.
+//
+// The IntrospectionClientID and IntrospectionClientSecret are the client credentials used to call the
+// introspection_endpoint published by the OP when the TokenIntrospection option is used. The opaque tokens
+// are only introspected with the providers having an IntrospectionClientID.
+//
+// The ClaimsValidators contains the validators run, in addition to the ones registered with the
+// ClaimsValidation option, against the tokens issued by this OP.
 type Provider struct {
-	Issuer    string
-	ClientIDs []string
+	Issuer                    string
+	ClientIDs                 []string
+	MetadataEndpoints         []string
+	AllowedJwksHosts          []string
+	Leeway                    *time.Duration
+	TokenAge                  *TokenAgePolicy
+	SigningAlgorithms         []string
+	Audiences                 []string
+	RolesClaims               []string
+	IntrospectionClientID     string
+	IntrospectionClientSecret string
+	ClaimsValidators          []ClaimsValidator
 }
 
 // The GetProvidersFunc defines the function type used to retrieve the collection of allowed OP(s) along with the
@@ -32,17 +83,91 @@ func (f GetProvidersFunc) get() ([]Provider, error) {
 // providers represent a collection of OPs.
 type providers []Provider
 
+type providerSettings struct {
+	normalizeIssuer        bool
+	allowInsecureLocalhost bool
+	audiences              []string
+}
+
+type providerOption func(*providerSettings) error
+
 // NewProvider returns a new instance of a Provider created with the given issuer and clientIDs.
-func NewProvider(issuer string, clientIDs []string) (Provider, error) {
-	p := Provider{issuer, clientIDs}
+// The issuer must be a URL using the https scheme, with a host and without query or fragment
+// components, as required by the OpenID Connect Discovery specification.
+// This function also receives a collection of the function type providerOption which can relax
+// or complement the issuer validation.
+func NewProvider(issuer string, clientIDs []string, options ...providerOption) (Provider, error) {
+	var s providerSettings
+	for _, option := range options {
+		if err := option(&s); err != nil {
+			return Provider{}, err
+		}
+	}
+
+	if s.normalizeIssuer {
+		issuer = normalizeIssuer(issuer)
+	}
+
+	p := Provider{Issuer: issuer, ClientIDs: clientIDs, Audiences: s.audiences}
 
 	if err := p.validate(); err != nil {
 		return Provider{}, err
 	}
 
+	if err := validateIssuerSyntax(issuer, s); err != nil {
+		return Provider{}, err
+	}
+
 	return p, nil
 }
 
+// NormalizeIssuer option makes NewProvider normalize the issuer before validating it:
+// the scheme and host are lowercased, the default https port and a trailing slash are removed.
+// The normalized issuer must still match exactly the 'iss' claim of the tokens issued by the OP,
+// so this option must not be used with OPs whose issuer ends with a slash.
+func NormalizeIssuer() func(*providerSettings) error {
+	return func(s *providerSettings) error {
+		s.normalizeIssuer = true
+		return nil
+	}
+}
+
+// AllowInsecureLocalhost option makes NewProvider accept issuers using the http scheme when
+// their host is localhost or a loopback address. It is meant for OPs running locally during tests.
+func AllowInsecureLocalhost() func(*providerSettings) error {
+	return func(s *providerSettings) error {
+		s.allowInsecureLocalhost = true
+		return nil
+	}
+}
+
+// AccessTokenAudiences option makes NewProvider set the Audiences of the Provider, the identifiers
+// of the resources accepted in the 'aud' claim of the access tokens. When it is used the clientIDs
+// given to NewProvider may be empty.
+func AccessTokenAudiences(audiences ...string) func(*providerSettings) error {
+	return func(s *providerSettings) error {
+		s.audiences = append(s.audiences, audiences...)
+		return nil
+	}
+}
+
+// find returns the provider with the given issuer or nil if there is none.
+func (ps providers) find(iss string) *Provider {
+	// Workaround for tokens issued by google
+	gi := iss
+	if gi == "accounts.google.com" {
+		gi = "https://" + gi
+	}
+
+	for _, p := range ps {
+		if iss == p.Issuer || gi == p.Issuer {
+			return &p
+		}
+	}
+
+	return nil
+}
+
 func (ps providers) validate() error {
 	if len(ps) == 0 {
 		return &SetupError{
@@ -65,6 +190,10 @@ func (p Provider) validate() error {
 		return err
 	}
 
+	if len(p.Audiences) > 0 {
+		return nil
+	}
+
 	return validateProviderClientIDs(p.ClientIDs)
 }
 
@@ -76,15 +205,74 @@ func validateProviderIssuer(iss string) error {
 		}
 	}
 
-	// TODO: Validate that the issuer format complies with openid spec.
 	return nil
 }
 
+func validateIssuerSyntax(iss string, s providerSettings) error {
+	u, err := url.Parse(iss)
+	if err != nil {
+		return &SetupError{
+			Code:    SetupErrorInvalidIssuer,
+			Message: fmt.Sprintf("The issuer %v is not a valid URL.", iss),
+			Err:     err,
+		}
+	}
+
+	if u.Scheme != "https" && !(s.allowInsecureLocalhost && u.Scheme == "http" && isLocalhost(u.Hostname())) {
+		return &SetupError{
+			Code:    SetupErrorInvalidIssuer,
+			Message: fmt.Sprintf("The issuer %v must use the https scheme.", iss),
+		}
+	}
+
+	if u.Host == "" {
+		return &SetupError{
+			Code:    SetupErrorInvalidIssuer,
+			Message: fmt.Sprintf("The issuer %v does not have a host.", iss),
+		}
+	}
+
+	if u.User != nil || u.RawQuery != "" || u.ForceQuery || u.Fragment != "" || strings.Contains(iss, "#") {
+		return &SetupError{
+			Code:    SetupErrorInvalidIssuer,
+			Message: fmt.Sprintf("The issuer %v must not contain user information, query or fragment components.", iss),
+		}
+	}
+
+	return nil
+}
+
+func normalizeIssuer(iss string) string {
+	u, err := url.Parse(iss)
+	if err != nil {
+		return iss
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if u.Scheme == "https" {
+		u.Host = strings.TrimSuffix(u.Host, ":443")
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	return u.String()
+}
+
+func isLocalhost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 func validateProviderClientIDs(cIDs []string) error {
 	if len(cIDs) == 0 {
 		return &SetupError{
 			Code:    SetupErrorInvalidClientIDs,
-			Message: "At leat one client id must be provided.",
+			Message: "At least one client id or audience must be provided.",
 		}
 	}
 
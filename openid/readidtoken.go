@@ -1,6 +1,8 @@
 package openid
 
 import (
+	"fmt"
+	"mime"
 	"net/http"
 	"strings"
 )
@@ -44,3 +46,170 @@ func getIDTokenAuthorizationHeader(r *http.Request) (t string, err error) {
 
 	return p[1], nil
 }
+
+const accessTokenFormParameter = "access_token"
+
+// IDTokenGetter option registers the function responsible for extracting the token from the
+// requests, replacing the default one reading the 'Authorization: Bearer' header. The getters
+// returned by the IDTokenFrom functions can be used, alone or combined with IDTokenFromAny.
+func IDTokenGetter(tg GetIDTokenFunc) func(*Configuration) error {
+	return func(c *Configuration) error {
+		if tg == nil {
+			return &SetupError{
+				Code:    SetupErrorInvalidIDTokenGetter,
+				Message: "The id token getter must not be nil.",
+			}
+		}
+
+		c.idTokenGetter = tg
+		return nil
+	}
+}
+
+// IDTokenFromAuthorizationHeader returns the default getter, reading the token from the
+// Authorization header with the format 'Bearer TokenString'.
+func IDTokenFromAuthorizationHeader() GetIDTokenFunc {
+	return getIDTokenAuthorizationHeader
+}
+
+// IDTokenFromCookie returns the getter reading the token from the cookie with the given name.
+// The requests sending more than one cookie with that name are rejected.
+func IDTokenFromCookie(name string) GetIDTokenFunc {
+	return func(r *http.Request) (string, error) {
+		var vs []string
+		for _, c := range r.Cookies() {
+			if c.Name == name {
+				vs = append(vs, c.Value)
+			}
+		}
+
+		return singleValue(vs, fmt.Sprintf("The '%v' cookie was not found or was empty.", name))
+	}
+}
+
+// IDTokenFromQuery returns the getter reading the token from the URL query parameter with the
+// given name, such as the 'access_token' parameter of RFC 6750 section 2.3. The requests with more
+// than one parameter with that name are rejected.
+func IDTokenFromQuery(name string) GetIDTokenFunc {
+	return func(r *http.Request) (string, error) {
+		var vs []string
+		if r.URL != nil {
+			vs = r.URL.Query()[name]
+		}
+
+		return singleValue(vs, fmt.Sprintf("The '%v' query parameter was not found or was empty.", name))
+	}
+}
+
+// IDTokenFromHeader returns the getter reading the token from the whole value of the header with
+// the given name, for instance 'X-Id-Token'.
+func IDTokenFromHeader(name string) GetIDTokenFunc {
+	return func(r *http.Request) (string, error) {
+		if t := r.Header.Get(name); t != "" {
+			return t, nil
+		}
+
+		return "", tokenNotFoundError(fmt.Sprintf("The '%v' header was not found or was empty.", name))
+	}
+}
+
+// IDTokenFromForm returns the getter reading the token from the 'access_token' parameter of form
+// encoded bodies, as described by RFC 6750 section 2.2. Only the requests with a body, other than
+// GET requests, with the content type application/x-www-form-urlencoded are considered.
+// The body is parsed with http.Request.ParseForm, the next handlers find its parameters in the
+// request PostForm. The requests whose body can not be parsed are rejected with the code
+// ValidationErrorInvalidRequestBody and the ones with more than one 'access_token' parameter with
+// the code ValidationErrorAmbiguousToken.
+func IDTokenFromForm() GetIDTokenFunc {
+	return func(r *http.Request) (string, error) {
+		nf := tokenNotFoundError("The 'access_token' form parameter was not found or was empty.")
+		if r.Method == http.MethodGet || r.Body == nil {
+			return "", nf
+		}
+
+		if ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || ct != "application/x-www-form-urlencoded" {
+			return "", nf
+		}
+
+		if err := r.ParseForm(); err != nil {
+			return "", &ValidationError{
+				Code:       ValidationErrorInvalidRequestBody,
+				Message:    "The form encoded body could not be parsed.",
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+			}
+		}
+
+		return singleValue(r.PostForm[accessTokenFormParameter], nf.Message)
+	}
+}
+
+// IDTokenFromAny returns the getter trying each of the given getters in order. The token must be
+// presented in exactly one of the ways they read: when none of them finds it the error has the code
+// ValidationErrorTokenNotFound, when more than one finds it the error has the code
+// ValidationErrorAmbiguousToken, as required by RFC 6750 section 2.
+// The getters not finding the token must return a *ValidationError with one of the codes
+// ValidationErrorTokenNotFound or ValidationErrorAuthorizationHeaderNotFound, the other errors are
+// returned as they are.
+func IDTokenFromAny(getters ...GetIDTokenFunc) GetIDTokenFunc {
+	return func(r *http.Request) (string, error) {
+		var token string
+		found := false
+		for _, g := range getters {
+			t, err := g(r)
+			if err != nil {
+				if isTokenNotFound(err) {
+					continue
+				}
+
+				return "", err
+			}
+
+			if found {
+				return "", ambiguousTokenError()
+			}
+
+			token, found = t, true
+		}
+
+		if !found {
+			return "", tokenNotFoundError("The token was not found on the request.")
+		}
+
+		return token, nil
+	}
+}
+
+// singleValue returns the token when exactly one value was found for it, the message describing
+// where it was looked for when none or an empty one was found.
+func singleValue(vs []string, notFound string) (string, error) {
+	switch {
+	case len(vs) > 1:
+		return "", ambiguousTokenError()
+	case len(vs) == 0 || vs[0] == "":
+		return "", tokenNotFoundError(notFound)
+	}
+
+	return vs[0], nil
+}
+
+func isTokenNotFound(err error) bool {
+	ve, ok := err.(*ValidationError)
+	return ok && (ve.Code == ValidationErrorTokenNotFound || ve.Code == ValidationErrorAuthorizationHeaderNotFound)
+}
+
+func tokenNotFoundError(m string) *ValidationError {
+	return &ValidationError{
+		Code:       ValidationErrorTokenNotFound,
+		Message:    m,
+		HTTPStatus: http.StatusBadRequest,
+	}
+}
+
+func ambiguousTokenError() *ValidationError {
+	return &ValidationError{
+		Code:       ValidationErrorAmbiguousToken,
+		Message:    "The token must be presented only once on the request.",
+		HTTPStatus: http.StatusBadRequest,
+	}
+}
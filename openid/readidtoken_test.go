@@ -3,7 +3,11 @@ package openid
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 // Data used for negative tests of GetIdTokenAuthorizationHeader.
@@ -74,3 +78,133 @@ func Test_getIDTokenAuthorizationHeader_CorrectHeaderContent(t *testing.T) {
 		t.Errorf("Expected result %v, got %v", et, rt)
 	}
 }
+
+func Test_IDTokenFromCookie(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "id_token", Value: "token"})
+
+	tk, err := IDTokenFromCookie("id_token")(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "token", tk)
+
+	_, err = IDTokenFromCookie("other")(r)
+	expectError(t, err, "cookie", ValidationErrorTokenNotFound, http.StatusBadRequest)
+
+	r.AddCookie(&http.Cookie{Name: "id_token", Value: "other"})
+
+	_, err = IDTokenFromCookie("id_token")(r)
+	expectError(t, err, "cookie", ValidationErrorAmbiguousToken, http.StatusBadRequest)
+}
+
+func Test_IDTokenFromQuery(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/?access_token=token", nil)
+
+	tk, err := IDTokenFromQuery("access_token")(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "token", tk)
+
+	_, err = IDTokenFromQuery("id_token")(r)
+	expectError(t, err, "query", ValidationErrorTokenNotFound, http.StatusBadRequest)
+
+	r = httptest.NewRequest(http.MethodGet, "/?access_token=token&access_token=other", nil)
+
+	_, err = IDTokenFromQuery("access_token")(r)
+	expectError(t, err, "query", ValidationErrorAmbiguousToken, http.StatusBadRequest)
+}
+
+func Test_IDTokenFromHeader(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Id-Token", "token")
+
+	tk, err := IDTokenFromHeader("X-Id-Token")(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "token", tk)
+
+	_, err = IDTokenFromHeader("X-Other")(r)
+	expectError(t, err, "header", ValidationErrorTokenNotFound, http.StatusBadRequest)
+}
+
+func Test_IDTokenFromForm(t *testing.T) {
+	r := createFormRequest(http.MethodPost, "application/x-www-form-urlencoded", "access_token=token&state=1")
+
+	tk, err := IDTokenFromForm()(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "token", tk)
+	assert.Equal(t, "1", r.PostForm.Get("state"), "The form should remain available to the next handlers.")
+}
+
+func Test_IDTokenFromForm_WhenTokenIsNotInTheBody(t *testing.T) {
+	tests := []*http.Request{
+		createFormRequest(http.MethodGet, "application/x-www-form-urlencoded", "access_token=token"),
+		createFormRequest(http.MethodPost, "application/json", `{"access_token":"token"}`),
+		createFormRequest(http.MethodPost, "application/x-www-form-urlencoded", "state=1"),
+		httptest.NewRequest(http.MethodPost, "/?access_token=token", nil),
+	}
+
+	for _, r := range tests {
+		_, err := IDTokenFromForm()(r)
+		expectError(t, err, "form", ValidationErrorTokenNotFound, http.StatusBadRequest)
+	}
+}
+
+func Test_IDTokenFromForm_WhenTokenIsRepeated(t *testing.T) {
+	r := createFormRequest(http.MethodPost, "application/x-www-form-urlencoded; charset=utf-8", "access_token=a&access_token=b")
+
+	_, err := IDTokenFromForm()(r)
+	expectError(t, err, "form", ValidationErrorAmbiguousToken, http.StatusBadRequest)
+}
+
+func Test_IDTokenFromForm_WhenBodyCanNotBeParsed(t *testing.T) {
+	r := createFormRequest(http.MethodPost, "application/x-www-form-urlencoded", "access_token=%zz")
+
+	_, err := IDTokenFromForm()(r)
+	expectError(t, err, "form", ValidationErrorInvalidRequestBody, http.StatusBadRequest)
+}
+
+func Test_IDTokenFromAny(t *testing.T) {
+	g := IDTokenFromAny(IDTokenFromAuthorizationHeader(), IDTokenFromCookie("id_token"), IDTokenFromQuery("access_token"))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "id_token", Value: "token"})
+
+	tk, err := g(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "token", tk)
+
+	_, err = g(httptest.NewRequest(http.MethodGet, "/", nil))
+	expectError(t, err, "none", ValidationErrorTokenNotFound, http.StatusBadRequest)
+
+	r = httptest.NewRequest(http.MethodGet, "/?access_token=token", nil)
+	r.Header.Set("Authorization", "Bearer token")
+
+	_, err = g(r)
+	expectError(t, err, "ambiguous", ValidationErrorAmbiguousToken, http.StatusBadRequest)
+
+	r = httptest.NewRequest(http.MethodGet, "/?access_token=token", nil)
+	r.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+
+	_, err = g(r)
+	expectError(t, err, "basic", ValidationErrorAuthorizationHeaderWrongSchemeName, http.StatusBadRequest)
+
+	r = createFormRequest(http.MethodPost, "application/x-www-form-urlencoded", "access_token=%zz")
+	r.AddCookie(&http.Cookie{Name: "id_token", Value: "token"})
+
+	_, err = IDTokenFromAny(IDTokenFromForm(), IDTokenFromCookie("id_token"))(r)
+	expectError(t, err, "form", ValidationErrorInvalidRequestBody, http.StatusBadRequest)
+}
+
+func Test_IDTokenGetter(t *testing.T) {
+	tg := IDTokenFromCookie("id_token")
+	c, err := NewConfiguration(IDTokenGetter(tg))
+	assert.NoError(t, err)
+	assert.NotNil(t, c.idTokenGetter)
+
+	_, err = NewConfiguration(IDTokenGetter(nil))
+	expectSetupError(t, err, SetupErrorInvalidIDTokenGetter)
+}
+
+func createFormRequest(method string, contentType string, body string) *http.Request {
+	r := httptest.NewRequest(method, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	return r
+}
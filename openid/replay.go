@@ -0,0 +1,199 @@
+package openid
+
+import (
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The ReplayStore records the tokens already used with the RequireSingleUse middleware.
+//
+// Add records the key until the given expiration time, zero when the token does not expire, and
+// returns false if the key was already recorded and has not expired. It must be atomic: when
+// called concurrently with the same key only one of the calls returns true.
+type ReplayStore interface {
+	Add(ctx context.Context, key string, expires time.Time) (bool, error)
+}
+
+// RequireSingleUse returns a middleware that rejects the tokens already used with it, allowing
+// each token to be used only once, before calling the next handler. The token is the one the
+// User stored in the request context was authenticated with. It must be stacked after
+// Authenticate, AuthenticateUser or Middleware, the requests without a User are rejected with the
+// code ValidationErrorReplayCheckFailure.
+// The tokens are identified by their issuer and 'jti' claim or, when they do not have one, by the
+// hash of the token, and are recorded in the ReplayStore until they expire, including the leeway
+// given to them by the Leeway option or their Provider.
+// Reused tokens are handled by the ErrorHandlerFunc as a *ValidationError with the code
+// ValidationErrorTokenReplayed.
+func RequireSingleUse(conf *Configuration, rs ReplayStore) func(http.Handler) http.Handler {
+	return userMiddleware(conf, func(u *User, r *http.Request) error {
+		return guardReplay(r, conf, rs, u)
+	})
+}
+
+func guardReplay(r *http.Request, conf *Configuration, rs ReplayStore, u *User) error {
+	if u == nil {
+		return &ValidationError{
+			Code:       ValidationErrorReplayCheckFailure,
+			Message:    "The request does not carry an authenticated user.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	claims := u.Claims
+
+	var key string
+	if jti := stringClaim(claims, jwtIDClaimName); jti != "" {
+		key = "jti:" + u.Issuer + ":" + jti
+	} else if u.rawToken != "" {
+		sum := sha256.Sum256([]byte(u.rawToken))
+		key = "sha256:" + base64.RawURLEncoding.EncodeToString(sum[:])
+	} else {
+		return &ValidationError{
+			Code:       ValidationErrorReplayCheckFailure,
+			Message:    "The token of the user does not have a 'jti' claim and is not available.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	// The token is accepted until it expires plus the leeway, it must be recorded until then.
+	exp, _, _ := getTimeClaim(claims, expirationClaimName)
+	if !exp.IsZero() {
+		exp = exp.Add(conf.leewayFor(u.Issuer))
+	}
+
+	first, err := rs.Add(r.Context(), key, exp)
+	if err != nil {
+		return &ValidationError{
+			Code:       ValidationErrorReplayCheckFailure,
+			Message:    "Failure while checking whether the token was already used.",
+			Err:        err,
+			HTTPStatus: http.StatusInternalServerError,
+		}
+	}
+
+	if !first {
+		return &ValidationError{
+			Code:       ValidationErrorTokenReplayed,
+			Message:    "The token was already used.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	return nil
+}
+
+// MemoryReplayStore is the in-memory ReplayStore. It records at most a fixed number of
+// tokens, the expired ones being removed as new ones are added. When it is full of tokens that
+// have not expired Add returns an error, failing the requests with
+// ValidationErrorReplayCheckFailure rather than allowing the recorded tokens to be used again.
+// The tokens expire according to the clock of the Configuration it is created with.
+type MemoryReplayStore struct {
+	mu       sync.Mutex
+	capacity int
+	keys     map[string]*replayEntry
+	queue    replayQueue
+	now      func() time.Time
+}
+
+var errReplayStoreFull = errors.New("the replay store is full")
+
+// NewMemoryReplayStore returns a MemoryReplayStore recording at most capacity tokens, using the
+// clock registered with the Clock option of the given Configuration.
+func NewMemoryReplayStore(conf *Configuration, capacity int) *MemoryReplayStore {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	now := time.Now
+	if conf != nil {
+		now = func() time.Time { return conf.clock() }
+	}
+
+	return &MemoryReplayStore{capacity: capacity, keys: make(map[string]*replayEntry), now: now}
+}
+
+// Add records the key until the expiration time and returns false if it was already recorded.
+func (s *MemoryReplayStore) Add(ctx context.Context, key string, expires time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if e, ok := s.keys[key]; ok {
+		if !e.expired(now) {
+			return false, nil
+		}
+
+		heap.Remove(&s.queue, e.index)
+		delete(s.keys, key)
+	}
+
+	for len(s.queue) > 0 && s.queue[0].expired(now) {
+		s.evict()
+	}
+
+	// Evicting tokens which have not expired would allow them to be used again.
+	if len(s.queue) >= s.capacity {
+		return false, errReplayStoreFull
+	}
+
+	e := &replayEntry{key: key, expires: expires}
+	heap.Push(&s.queue, e)
+	s.keys[key] = e
+
+	return true, nil
+}
+
+func (s *MemoryReplayStore) evict() {
+	e := heap.Pop(&s.queue).(*replayEntry)
+	delete(s.keys, e.key)
+}
+
+type replayEntry struct {
+	key     string
+	expires time.Time
+	index   int
+}
+
+func (e *replayEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// replayQueue is the heap of the recorded tokens ordered by expiration, the tokens which never
+// expire being last.
+type replayQueue []*replayEntry
+
+func (q replayQueue) Len() int { return len(q) }
+
+func (q replayQueue) Less(i, j int) bool {
+	if q[i].expires.IsZero() || q[j].expires.IsZero() {
+		return q[j].expires.IsZero() && !q[i].expires.IsZero()
+	}
+
+	return q[i].expires.Before(q[j].expires)
+}
+
+func (q replayQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *replayQueue) Push(x interface{}) {
+	e := x.(*replayEntry)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *replayQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,188 @@
+package openid
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_MemoryReplayStore_Add(t *testing.T) {
+	now := testNow
+	s := NewMemoryReplayStore(nil, 10)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	first, _ := s.Add(ctx, "a", now.Add(time.Minute))
+	assert.True(t, first)
+
+	first, _ = s.Add(ctx, "a", now.Add(time.Minute))
+	assert.False(t, first)
+
+	now = now.Add(time.Minute)
+
+	first, _ = s.Add(ctx, "a", now.Add(time.Minute))
+	assert.True(t, first, "The expired key should have been recorded again.")
+}
+
+func Test_MemoryReplayStore_Add_WhenFull(t *testing.T) {
+	now := testNow
+	s := NewMemoryReplayStore(nil, 3)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	s.Add(ctx, "never", time.Time{})
+	s.Add(ctx, "late", now.Add(time.Hour))
+	s.Add(ctx, "soon", now.Add(time.Minute))
+
+	first, err := s.Add(ctx, "new", now.Add(2*time.Hour))
+
+	assert.False(t, first)
+	assert.Equal(t, errReplayStoreFull, err)
+	assert.Len(t, s.keys, 3)
+	assert.Contains(t, s.keys, "soon", "The keys which have not expired should not be evicted.")
+
+	now = now.Add(90 * time.Minute)
+	first, err = s.Add(ctx, "other", now.Add(time.Hour))
+
+	assert.True(t, first)
+	assert.NoError(t, err)
+	assert.Len(t, s.keys, 2)
+	assert.NotContains(t, s.keys, "late", "The expired key should have been removed.")
+	assert.Contains(t, s.keys, "never")
+
+	first, _ = s.Add(ctx, "never", time.Time{})
+	assert.False(t, first)
+}
+
+func Test_MemoryReplayStore_Add_Concurrently(t *testing.T) {
+	s := NewMemoryReplayStore(nil, 100)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	firsts := 0
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if first, _ := s.Add(context.Background(), "key", time.Now().Add(time.Hour)); first {
+				mu.Lock()
+				firsts++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, 1, firsts)
+}
+
+func Test_RequireSingleUse(t *testing.T) {
+	var herr error
+	vm, c := createConfiguration(t, func(e error, w http.ResponseWriter, r *http.Request) bool {
+		herr = e
+		return true
+	}, getIDTokenReturnsSuccess)
+
+	withJti := createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "SUB1", "jti": "jti1", "exp": float64(time.Now().Add(time.Hour).Unix())})
+	withoutJti := createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "SUB1"})
+	withoutJti.Raw = "raw.token.value"
+
+	vm.On("validate", mock.Anything, idToken).Return(withJti, nil).Twice()
+	vm.On("validate", mock.Anything, idToken).Return(withoutJti, nil).Twice()
+
+	calls := 0
+	h := Middleware(c)(RequireSingleUse(c, NewMemoryReplayStore(c, 10))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	})))
+
+	for i := 0; i < 4; i++ {
+		herr = nil
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if i%2 == 0 {
+			assert.Nil(t, herr)
+		} else {
+			expectValidationError(t, herr, ValidationErrorTokenReplayed, http.StatusUnauthorized, nil)
+		}
+	}
+
+	assert.Equal(t, 2, calls)
+	vm.AssertExpectations(t)
+}
+
+func Test_RequireSingleUse_RecordsTokensDuringTheLeeway(t *testing.T) {
+	var herr error
+	vm, c := createConfiguration(t, func(e error, w http.ResponseWriter, r *http.Request) bool {
+		herr = e
+		return true
+	}, getIDTokenReturnsSuccess)
+
+	now := testNow
+	c.clock = func() time.Time { return now }
+	c.leeway = time.Minute
+
+	jt := createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "SUB1", "jti": "jti1", "exp": float64(testNow.Add(time.Second).Unix())})
+	vm.On("validate", mock.Anything, idToken).Return(jt, nil)
+
+	h := Middleware(c)(RequireSingleUse(c, NewMemoryReplayStore(c, 10))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Nil(t, herr)
+
+	// The token is expired but still accepted thanks to the leeway.
+	now = testNow.Add(30 * time.Second)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	expectValidationError(t, herr, ValidationErrorTokenReplayed, http.StatusUnauthorized, nil)
+
+	herr = nil
+	now = testNow.Add(2 * time.Minute)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Nil(t, herr, "The token should have been removed once the leeway elapsed.")
+}
+
+func Test_RequireSingleUse_WhenStoreFails(t *testing.T) {
+	var herr error
+	vm, c := createConfiguration(t, func(e error, w http.ResponseWriter, r *http.Request) bool {
+		herr = e
+		return true
+	}, getIDTokenReturnsSuccess)
+
+	vm.On("validate", mock.Anything, idToken).Return(createRawToken(), nil)
+
+	ee := errors.New("unavailable")
+	rs := replayStoreFunc(func(ctx context.Context, key string, expires time.Time) (bool, error) { return false, ee })
+
+	Middleware(c)(RequireSingleUse(c, rs)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("The handler should not have been called.")
+	}))).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	expectValidationError(t, herr, ValidationErrorReplayCheckFailure, http.StatusInternalServerError, ee)
+	vm.AssertExpectations(t)
+}
+
+func Test_RequireSingleUse_WhenUserIsNotInContext(t *testing.T) {
+	var herr error
+	_, c := createConfiguration(t, func(e error, w http.ResponseWriter, r *http.Request) bool {
+		herr = e
+		return true
+	}, nil)
+
+	RequireSingleUse(c, NewMemoryReplayStore(c, 10))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("The handler should not have been called.")
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	expectValidationError(t, herr, ValidationErrorReplayCheckFailure, http.StatusUnauthorized, nil)
+}
+
+type replayStoreFunc func(ctx context.Context, key string, expires time.Time) (bool, error)
+
+func (f replayStoreFunc) Add(ctx context.Context, key string, expires time.Time) (bool, error) {
+	return f(ctx, key, expires)
+}
@@ -0,0 +1,154 @@
+package openid
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	neturl "net/url"
+	"time"
+)
+
+// RetryPolicy determines how the requests sent to the OP endpoints, i.e.: the configuration
+// and jwk set endpoints, are retried when they fail with a transient error.
+//
+// The MaxAttempts is the maximum number of times a request is sent, including the first one.
+// A value of 1 disables retries.
+//
+// The InitialBackoff is the time waited before the first retry. The wait time doubles after each
+// subsequent retry until it reaches MaxBackoff, when MaxBackoff is greater than zero.
+//
+// The Jitter is a fraction, between 0 and 1, of the wait time that is randomly subtracted from it
+// so that multiple instances of the service do not retry in lockstep.
+//
+// A request is retried when the HTTP call returns an error or when the response status code
+// is 429/Too Many Requests or any 5xx.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Jitter         float64
+}
+
+// HTTPRetry option registers the policy used to retry the requests sent to the OP endpoints.
+// When this option is not used the requests are not retried.
+func HTTPRetry(rp RetryPolicy) func(*Configuration) error {
+	return func(c *Configuration) error {
+		if err := rp.validate(); err != nil {
+			return err
+		}
+
+		c.retryPolicy = &rp
+		return nil
+	}
+}
+
+func (rp RetryPolicy) validate() error {
+	if rp.MaxAttempts < 1 {
+		return &SetupError{
+			Code:    SetupErrorInvalidRetryPolicy,
+			Message: "The retry policy must allow at least one attempt.",
+		}
+	}
+
+	if rp.InitialBackoff < 0 || rp.MaxBackoff < 0 {
+		return &SetupError{
+			Code:    SetupErrorInvalidRetryPolicy,
+			Message: "The retry policy backoff durations must not be negative.",
+		}
+	}
+
+	if rp.Jitter < 0 || rp.Jitter > 1 {
+		return &SetupError{
+			Code:    SetupErrorInvalidRetryPolicy,
+			Message: "The retry policy jitter must be between 0 and 1.",
+		}
+	}
+
+	return nil
+}
+
+// backoff returns the time to wait before the given retry, starting at 1.
+func (rp RetryPolicy) backoff(retry int, random float64) time.Duration {
+	d := rp.InitialBackoff
+	for i := 1; i < retry; i++ {
+		if rp.MaxBackoff > 0 && d >= rp.MaxBackoff || d > math.MaxInt64/2 {
+			break
+		}
+
+		d *= 2
+	}
+
+	if rp.MaxBackoff > 0 && d > rp.MaxBackoff {
+		d = rp.MaxBackoff
+	}
+
+	return d - time.Duration(float64(d)*rp.Jitter*random)
+}
+
+type retryHTTPGetter struct {
+	getter httpGetter
+	policy RetryPolicy
+	wait   func(r *http.Request, d time.Duration) error
+	random func() float64
+}
+
+func newRetryHTTPGetter(hg httpGetter, rp RetryPolicy) *retryHTTPGetter {
+	return &retryHTTPGetter{hg, rp, waitForRequest, rand.Float64}
+}
+
+func (g *retryHTTPGetter) get(r *http.Request, url string) (*http.Response, error) {
+	resp, err := g.getter.get(r, url)
+
+	for retry := 1; retry < g.policy.MaxAttempts && shouldRetry(resp, err); retry++ {
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		if werr := g.wait(r, g.policy.backoff(retry, g.random())); werr != nil {
+			return nil, werr
+		}
+
+		resp, err = g.getter.get(r, url)
+	}
+
+	return resp, err
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		_, violation := policyViolation(err)
+		return !violation
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// waitForRequest waits for the given duration or until the contextual request is cancelled.
+func waitForRequest(r *http.Request, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	if r == nil {
+		<-t.C
+		return nil
+	}
+
+	select {
+	case <-t.C:
+		return nil
+	case <-r.Context().Done():
+		return r.Context().Err()
+	}
+}
+
+// policyViolation returns the error reported when the request was refused by the restrictions
+// enforced by this package, such as the JwksURIPolicy. Retrying such requests does not change
+// the outcome.
+func policyViolation(err error) (*ValidationError, bool) {
+	if uerr, ok := err.(*neturl.Error); ok {
+		err = uerr.Err
+	}
+
+	verr, ok := err.(*ValidationError)
+	return verr, ok
+}
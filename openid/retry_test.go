@@ -0,0 +1,171 @@
+package openid
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_retryHTTPGetter_get_WhenFirstAttemptSucceeds(t *testing.T) {
+	hg, rg, waits := createRetryHTTPGetter(t, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second})
+
+	resp := &http.Response{StatusCode: http.StatusOK, Body: testBody{bytes.NewBufferString("")}}
+	hg.On("get", (*http.Request)(nil), "https://jwks").Return(resp, nil).Once()
+
+	rr, err := rg.get(nil, "https://jwks")
+
+	if err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+
+	if rr != resp {
+		t.Errorf("Expected response %+v, but got %+v.", resp, rr)
+	}
+
+	if len(*waits) != 0 {
+		t.Error("No backoff was expected, but waited", *waits)
+	}
+
+	hg.AssertExpectations(t)
+}
+
+func Test_retryHTTPGetter_get_WhenTransientErrorsThenSuccess(t *testing.T) {
+	hg, rg, waits := createRetryHTTPGetter(t, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second})
+
+	resp := &http.Response{StatusCode: http.StatusOK, Body: testBody{bytes.NewBufferString("")}}
+	hg.On("get", (*http.Request)(nil), mock.Anything).Return(nil, errors.New("connection reset")).Once()
+	hg.On("get", (*http.Request)(nil), mock.Anything).Return(&http.Response{StatusCode: http.StatusBadGateway, Body: testBody{bytes.NewBufferString("")}}, nil).Once()
+	hg.On("get", (*http.Request)(nil), mock.Anything).Return(resp, nil).Once()
+
+	rr, err := rg.get(nil, "https://jwks")
+
+	if err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+
+	if rr != resp {
+		t.Errorf("Expected response %+v, but got %+v.", resp, rr)
+	}
+
+	expectWaits(t, *waits, time.Second, 2*time.Second)
+	hg.AssertExpectations(t)
+}
+
+func Test_retryHTTPGetter_get_WhenAllAttemptsFail(t *testing.T) {
+	hg, rg, waits := createRetryHTTPGetter(t, RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Second, MaxBackoff: 3 * time.Second})
+
+	ee := errors.New("connection refused")
+	hg.On("get", (*http.Request)(nil), mock.Anything).Return(nil, ee).Times(4)
+
+	_, err := rg.get(nil, "https://jwks")
+
+	if err != ee {
+		t.Error("Expected error", ee, "but got", err)
+	}
+
+	expectWaits(t, *waits, time.Second, 2*time.Second, 3*time.Second)
+	hg.AssertExpectations(t)
+}
+
+func Test_retryHTTPGetter_get_DoesNotRetryClientErrors(t *testing.T) {
+	hg, rg, _ := createRetryHTTPGetter(t, RetryPolicy{MaxAttempts: 3})
+
+	resp := &http.Response{StatusCode: http.StatusNotFound, Body: testBody{bytes.NewBufferString("")}}
+	hg.On("get", (*http.Request)(nil), mock.Anything).Return(resp, nil).Once()
+
+	rr, err := rg.get(nil, "https://jwks")
+
+	if err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+
+	if rr != resp {
+		t.Errorf("Expected response %+v, but got %+v.", resp, rr)
+	}
+
+	hg.AssertExpectations(t)
+}
+
+func Test_retryHTTPGetter_get_WhenRequestIsCancelled(t *testing.T) {
+	hg := &mockHTTPGetter{}
+	rg := newRetryHTTPGetter(hg, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	hg.On("get", req, mock.Anything).Return(nil, errors.New("connection reset")).Once()
+
+	_, err := rg.get(req, "https://jwks")
+
+	if err != context.Canceled {
+		t.Error("Expected error", context.Canceled, "but got", err)
+	}
+
+	hg.AssertExpectations(t)
+}
+
+func Test_RetryPolicy_backoff_AppliesJitter(t *testing.T) {
+	rp := RetryPolicy{MaxAttempts: 3, InitialBackoff: 4 * time.Second, Jitter: 0.5}
+
+	if d := rp.backoff(1, 0); d != 4*time.Second {
+		t.Error("Expected backoff", 4*time.Second, "but got", d)
+	}
+
+	if d := rp.backoff(1, 1); d != 2*time.Second {
+		t.Error("Expected backoff", 2*time.Second, "but got", d)
+	}
+
+	if d := rp.backoff(2, 0.5); d != 6*time.Second {
+		t.Error("Expected backoff", 6*time.Second, "but got", d)
+	}
+}
+
+func Test_HTTPRetry_WithInvalidPolicy(t *testing.T) {
+	for _, rp := range []RetryPolicy{
+		{MaxAttempts: 0},
+		{MaxAttempts: 2, InitialBackoff: -time.Second},
+		{MaxAttempts: 2, Jitter: 1.5},
+	} {
+		_, err := NewConfiguration(HTTPRetry(rp))
+		expectSetupError(t, err, SetupErrorInvalidRetryPolicy)
+	}
+}
+
+func createRetryHTTPGetter(t *testing.T, rp RetryPolicy) (*mockHTTPGetter, *retryHTTPGetter, *[]time.Duration) {
+	hg := &mockHTTPGetter{}
+	waits := &[]time.Duration{}
+	rg := newRetryHTTPGetter(hg, rp)
+	rg.random = func() float64 { return 0 }
+	rg.wait = func(r *http.Request, d time.Duration) error {
+		*waits = append(*waits, d)
+		return nil
+	}
+
+	return hg, rg, waits
+}
+
+func expectWaits(t *testing.T, waits []time.Duration, expected ...time.Duration) {
+	if len(waits) != len(expected) {
+		t.Fatal("Expected waits", expected, "but got", waits)
+	}
+
+	for i, w := range expected {
+		if waits[i] != w {
+			t.Error("Expected wait", w, "at", i, "but got", waits[i])
+		}
+	}
+}
+
+func Test_RetryPolicy_backoff_DoesNotOverflow(t *testing.T) {
+	rp := RetryPolicy{MaxAttempts: 100, InitialBackoff: time.Second}
+
+	if d := rp.backoff(99, 0); d <= 0 {
+		t.Error("Expected a positive backoff but got", d)
+	}
+}
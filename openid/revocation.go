@@ -0,0 +1,296 @@
+package openid
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const sessionIDClaimName = "sid"
+
+// Revocation represents the revocation of tokens issued by the OP with the given Issuer. Exactly
+// one of the following must be set:
+//
+//   - the JwtID revokes the token with that 'jti' claim;
+//   - the SessionID revokes the tokens with that 'sid' claim;
+//   - the Subject revokes the tokens with that 'sub' claim or, when IssuedBefore is not zero,
+//     only the ones issued before that time.
+//
+// The TTL is how long the revocation is kept, it should be at least the lifetime of the tokens.
+type Revocation struct {
+	Issuer       string
+	JwtID        string
+	SessionID    string
+	Subject      string
+	IssuedBefore time.Time
+	TTL          time.Duration
+}
+
+// RevokedToken contains the claims of a validated token used to check whether it was revoked.
+// The IssuedAt is zero when the token does not have an 'iat' claim.
+type RevokedToken struct {
+	Issuer    string
+	JwtID     string
+	SessionID string
+	Subject   string
+	IssuedAt  time.Time
+}
+
+// The RevocationStore stores the revocations of tokens. It is consulted, through the
+// TokenRevocation option, for every token after its signature is verified.
+//
+// Revoke registers a revocation. IsRevoked returns whether the token matches any of the
+// revocations registered and not expired. Errors returned by IsRevoked are wrapped in a
+// *ValidationError with the code ValidationErrorRevocationCheckFailure.
+type RevocationStore interface {
+	Revoke(ctx context.Context, rv Revocation) error
+	IsRevoked(ctx context.Context, t RevokedToken) (bool, error)
+}
+
+// TokenRevocation option registers the RevocationStore consulted to reject revoked tokens with
+// the code ValidationErrorTokenRevoked. When this option is not used the tokens are not checked
+// for revocation.
+func TokenRevocation(rs RevocationStore) func(*Configuration) error {
+	return func(c *Configuration) error {
+		c.tokenValidator.(*idTokenValidator).revocationStore = rs
+		return nil
+	}
+}
+
+func (tv *idTokenValidator) validateRevocation(r *http.Request, jt *jwtToken) error {
+	if tv.revocationStore == nil {
+		return nil
+	}
+
+	claims := jt.Claims
+	t := RevokedToken{
+		Issuer:    stringClaim(claims, issuerClaimName),
+		JwtID:     stringClaim(claims, jwtIDClaimName),
+		SessionID: stringClaim(claims, sessionIDClaimName),
+		Subject:   stringClaim(claims, subjectClaimName),
+	}
+
+	if iat, ok, _ := getTimeClaim(claims, issuedAtClaimName); ok {
+		t.IssuedAt = iat
+	}
+
+	ctx := context.Background()
+	if r != nil {
+		ctx = r.Context()
+	}
+
+	revoked, err := tv.revocationStore.IsRevoked(ctx, t)
+	if err != nil {
+		return &ValidationError{
+			Code:       ValidationErrorRevocationCheckFailure,
+			Message:    "Failure while checking whether the token was revoked.",
+			Err:        err,
+			HTTPStatus: http.StatusInternalServerError,
+		}
+	}
+
+	if revoked {
+		return &ValidationError{
+			Code:       ValidationErrorTokenRevoked,
+			Message:    "The token was revoked.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	return nil
+}
+
+func (rv Revocation) validate() error {
+	keys := 0
+	for _, k := range []string{rv.JwtID, rv.SessionID, rv.Subject} {
+		if k != "" {
+			keys++
+		}
+	}
+
+	switch {
+	case rv.Issuer == "":
+		return errors.New("the revocation issuer is required")
+	case keys != 1:
+		return errors.New("exactly one of the revocation jti, sid or sub is required")
+	case !rv.IssuedBefore.IsZero() && rv.Subject == "":
+		return errors.New("the revocation issued before time requires a sub")
+	case rv.TTL <= 0:
+		return errors.New("the revocation ttl must be greater than zero")
+	}
+
+	return nil
+}
+
+// MemoryRevocationStore is the in-memory RevocationStore. The revocations are removed once
+// their TTL elapses. The zero value is ready to use.
+type MemoryRevocationStore struct {
+	mu      sync.Mutex
+	entries map[revocationKey]revocationEntry
+	now     func() time.Time
+}
+
+type revocationKey struct {
+	kind   string
+	issuer string
+	value  string
+}
+
+type revocationEntry struct {
+	expires      time.Time
+	issuedBefore time.Time
+}
+
+// Revoke registers the revocation until its TTL elapses.
+func (s *MemoryRevocationStore) Revoke(ctx context.Context, rv Revocation) error {
+	if err := rv.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock()
+	if s.entries == nil {
+		s.entries = make(map[revocationKey]revocationEntry)
+	}
+
+	for k, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+
+	k := revocationKey{kind: jwtIDClaimName, issuer: rv.Issuer, value: rv.JwtID}
+	if rv.SessionID != "" {
+		k = revocationKey{kind: sessionIDClaimName, issuer: rv.Issuer, value: rv.SessionID}
+	} else if rv.Subject != "" {
+		k = revocationKey{kind: subjectClaimName, issuer: rv.Issuer, value: rv.Subject}
+	}
+
+	e := revocationEntry{expires: now.Add(rv.TTL), issuedBefore: rv.IssuedBefore}
+	if prev, ok := s.entries[k]; ok && now.Before(prev.expires) {
+		// Keep the broadest of the subject revocations: a zero issuedBefore revokes all the tokens.
+		if prev.issuedBefore.IsZero() || (!e.issuedBefore.IsZero() && prev.issuedBefore.After(e.issuedBefore)) {
+			e.issuedBefore = prev.issuedBefore
+		}
+
+		if prev.expires.After(e.expires) {
+			e.expires = prev.expires
+		}
+	}
+
+	s.entries[k] = e
+	return nil
+}
+
+// IsRevoked returns whether the token matches any of the revocations not expired.
+func (s *MemoryRevocationStore) IsRevoked(ctx context.Context, t RevokedToken) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock()
+	active := func(kind string, value string) (revocationEntry, bool) {
+		if value == "" {
+			return revocationEntry{}, false
+		}
+
+		e, ok := s.entries[revocationKey{kind: kind, issuer: t.Issuer, value: value}]
+		return e, ok && now.Before(e.expires)
+	}
+
+	if _, ok := active(jwtIDClaimName, t.JwtID); ok {
+		return true, nil
+	}
+
+	if _, ok := active(sessionIDClaimName, t.SessionID); ok {
+		return true, nil
+	}
+
+	if e, ok := active(subjectClaimName, t.Subject); ok {
+		return e.issuedBefore.IsZero() || t.IssuedAt.IsZero() || t.IssuedAt.Before(e.issuedBefore), nil
+	}
+
+	return false, nil
+}
+
+func (s *MemoryRevocationStore) clock() time.Time {
+	if s.now == nil {
+		return time.Now()
+	}
+
+	return s.now()
+}
+
+// maxRevocationBodySize is the maximum size of the revocations accepted by the RevocationHandler.
+const maxRevocationBodySize = 64 << 10
+
+// maxRevocationTTL is the maximum ttl, in seconds, accepted by the RevocationHandler.
+const maxRevocationTTL = int64(math.MaxInt64 / time.Second)
+
+// RevocationHandler returns the administration handler registering revocations in the given
+// RevocationStore. It accepts POST requests with a JSON body such as:
+//
+//	{"iss": "https://issuer", "sub": "user1", "issued_before": 1700000000, "ttl": 3600}
+//
+// where 'issued_before' is in seconds since the epoch and 'ttl' in seconds. It responds with
+// the status 204 when the revocation is registered. Bodies larger than 64KB and ttls that can not
+// be represented as a time.Duration are rejected.
+// The handler does not authenticate the callers, it must be protected by the application.
+func RevocationHandler(rs RevocationStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Only the POST method is allowed.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var body struct {
+			Issuer       string `json:"iss"`
+			JwtID        string `json:"jti"`
+			SessionID    string `json:"sid"`
+			Subject      string `json:"sub"`
+			IssuedBefore int64  `json:"issued_before"`
+			TTL          int64  `json:"ttl"`
+		}
+
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRevocationBodySize)).Decode(&body); err != nil {
+			http.Error(w, "The revocation could not be decoded.", http.StatusBadRequest)
+			return
+		}
+
+		// Larger ttls would overflow when converted to a time.Duration.
+		if body.TTL > maxRevocationTTL {
+			http.Error(w, "The revocation ttl is out of range.", http.StatusBadRequest)
+			return
+		}
+
+		rv := Revocation{
+			Issuer:    body.Issuer,
+			JwtID:     body.JwtID,
+			SessionID: body.SessionID,
+			Subject:   body.Subject,
+			TTL:       time.Duration(body.TTL) * time.Second,
+		}
+
+		if body.IssuedBefore != 0 {
+			rv.IssuedBefore = time.Unix(body.IssuedBefore, 0)
+		}
+
+		if err := rv.validate(); err != nil {
+			http.Error(w, "The revocation is not valid: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := rs.Revoke(r.Context(), rv); err != nil {
+			http.Error(w, "The revocation could not be registered: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
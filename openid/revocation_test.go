@@ -0,0 +1,156 @@
+package openid
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_MemoryRevocationStore_IsRevoked(t *testing.T) {
+	now := testNow
+	s := &MemoryRevocationStore{now: func() time.Time { return now }}
+	ctx := context.Background()
+
+	assert.Nil(t, s.Revoke(ctx, Revocation{Issuer: "https://issuer", JwtID: "jti1", TTL: time.Hour}))
+	assert.Nil(t, s.Revoke(ctx, Revocation{Issuer: "https://issuer", SessionID: "sid1", TTL: time.Hour}))
+	assert.Nil(t, s.Revoke(ctx, Revocation{Issuer: "https://issuer", Subject: "sub1", TTL: time.Hour}))
+	assert.Nil(t, s.Revoke(ctx, Revocation{Issuer: "https://issuer", Subject: "sub2", IssuedBefore: now, TTL: time.Hour}))
+
+	for _, c := range []struct {
+		token   RevokedToken
+		revoked bool
+	}{
+		{RevokedToken{Issuer: "https://issuer", JwtID: "jti1"}, true},
+		{RevokedToken{Issuer: "https://other", JwtID: "jti1"}, false},
+		{RevokedToken{Issuer: "https://issuer", JwtID: "jti2", SessionID: "sid1"}, true},
+		{RevokedToken{Issuer: "https://issuer", Subject: "sub1", IssuedAt: now.Add(time.Minute)}, true},
+		{RevokedToken{Issuer: "https://issuer", Subject: "sub2", IssuedAt: now.Add(-time.Minute)}, true},
+		{RevokedToken{Issuer: "https://issuer", Subject: "sub2", IssuedAt: now.Add(time.Minute)}, false},
+		{RevokedToken{Issuer: "https://issuer", Subject: "sub2"}, true},
+		{RevokedToken{Issuer: "https://issuer", Subject: "sub3"}, false},
+	} {
+		revoked, err := s.IsRevoked(ctx, c.token)
+
+		assert.Nil(t, err)
+		assert.Equal(t, c.revoked, revoked, "%+v", c.token)
+	}
+
+	now = now.Add(time.Hour)
+
+	revoked, _ := s.IsRevoked(ctx, RevokedToken{Issuer: "https://issuer", JwtID: "jti1"})
+	assert.False(t, revoked, "The revocation should have expired.")
+
+	assert.Nil(t, s.Revoke(ctx, Revocation{Issuer: "https://issuer", JwtID: "jti3", TTL: time.Hour}))
+	assert.Len(t, s.entries, 1, "The expired revocations should have been removed.")
+}
+
+func Test_MemoryRevocationStore_Revoke_KeepsTheBroadestSubjectRevocation(t *testing.T) {
+	s := &MemoryRevocationStore{now: func() time.Time { return testNow }}
+	ctx := context.Background()
+
+	s.Revoke(ctx, Revocation{Issuer: "https://issuer", Subject: "sub", IssuedBefore: testNow, TTL: time.Hour})
+	s.Revoke(ctx, Revocation{Issuer: "https://issuer", Subject: "sub", IssuedBefore: testNow.Add(-time.Hour), TTL: time.Hour})
+
+	revoked, _ := s.IsRevoked(ctx, RevokedToken{Issuer: "https://issuer", Subject: "sub", IssuedAt: testNow.Add(-time.Minute)})
+	assert.True(t, revoked)
+}
+
+func Test_MemoryRevocationStore_Revoke_WhenRevocationIsInvalid(t *testing.T) {
+	s := &MemoryRevocationStore{}
+
+	for _, rv := range []Revocation{
+		{JwtID: "jti", TTL: time.Hour},
+		{Issuer: "https://issuer", TTL: time.Hour},
+		{Issuer: "https://issuer", JwtID: "jti", Subject: "sub", TTL: time.Hour},
+		{Issuer: "https://issuer", JwtID: "jti", IssuedBefore: testNow, TTL: time.Hour},
+		{Issuer: "https://issuer", JwtID: "jti"},
+	} {
+		assert.NotNil(t, s.Revoke(context.Background(), rv), "%+v", rv)
+	}
+}
+
+func Test_validate_WhenTokenIsRevoked(t *testing.T) {
+	_, jm, _, _, tv := createIDTokenValidator(t)
+	s := &MemoryRevocationStore{}
+	s.Revoke(context.Background(), Revocation{Issuer: "https://issuer", Subject: "sub", IssuedBefore: time.Unix(1000, 0), TTL: time.Hour})
+	tv.revocationStore = s
+
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "sub", "iat": 999.0}), nil).Once()
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "sub", "iat": 1001.0}), nil).Once()
+
+	_, err := tv.validate(nil, mock.Anything)
+	expectValidationError(t, err, ValidationErrorTokenRevoked, http.StatusUnauthorized, nil)
+
+	_, err = tv.validate(nil, mock.Anything)
+	assert.Nil(t, err)
+
+	jm.AssertExpectations(t)
+}
+
+func Test_validate_WhenRevocationCheckFails(t *testing.T) {
+	_, jm, _, _, tv := createIDTokenValidator(t)
+	ee := errors.New("store unavailable")
+	tv.revocationStore = failingRevocationStore{ee}
+
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(createTokenWithClaims(jwtClaims{}), nil)
+
+	_, err := tv.validate(nil, mock.Anything)
+
+	expectValidationError(t, err, ValidationErrorRevocationCheckFailure, http.StatusInternalServerError, ee)
+	jm.AssertExpectations(t)
+}
+
+func Test_RevocationHandler(t *testing.T) {
+	s := &MemoryRevocationStore{}
+	h := RevocationHandler(s)
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"iss": "https://issuer", "sub": "sub", "issued_before": 1000, "ttl": 60}`)))
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+
+	revoked, _ := s.IsRevoked(context.Background(), RevokedToken{Issuer: "https://issuer", Subject: "sub", IssuedAt: time.Unix(999, 0)})
+	assert.True(t, revoked)
+
+	for _, body := range []string{`{`, `{"iss": "https://issuer", "sub": "sub"}`, `{"sub": "sub", "ttl": 60}`,
+		`{"iss": "https://issuer", "sub": "sub", "ttl": 18446744074}`, `{"iss": "https://issuer", "sub": "sub", "ttl": 1e30}`} {
+		rw = httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, rw.Code, body)
+	}
+
+	rw = httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"ttl": "x"}`)))
+	assert.Equal(t, "The revocation could not be decoded.\n", rw.Body.String(), "The decoder error should not be sent to the caller.")
+
+	rw = httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+
+	large := `{"iss": "https://issuer", "sub": "` + strings.Repeat("a", maxRevocationBodySize) + `", "ttl": 60}`
+	rw = httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(large)))
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	rw = httptest.NewRecorder()
+	RevocationHandler(failingRevocationStore{errors.New("unavailable")}).ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"iss": "https://issuer", "jti": "jti", "ttl": 60}`)))
+	assert.Equal(t, http.StatusInternalServerError, rw.Code)
+}
+
+type failingRevocationStore struct {
+	err error
+}
+
+func (s failingRevocationStore) Revoke(ctx context.Context, rv Revocation) error {
+	return s.err
+}
+
+func (s failingRevocationStore) IsRevoked(ctx context.Context, t RevokedToken) (bool, error) {
+	return false, s.err
+}
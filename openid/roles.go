@@ -0,0 +1,125 @@
+package openid
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const defaultRolesClaim = "roles"
+const claimPathSeparator = "."
+
+// RequireAnyRole returns a middleware that verifies that the User stored in the request context
+// has one of the given roles before calling the next handler. The roles are read from the
+// RolesClaims of the Provider that issued the token. It must be stacked after Authenticate,
+// AuthenticateUser or Middleware, the requests without a User are rejected.
+// When the user does not have the roles the error is handled by the ErrorHandlerFunc as an
+// *AuthorizationError with the code AuthorizationErrorMissingRole. The default behavior stops
+// the execution and returns Forbidden.
+func RequireAnyRole(conf *Configuration, roles []string) func(http.Handler) http.Handler {
+	return requireRoles(conf, roles, false)
+}
+
+// RequireAllRoles returns a middleware that performs the same verification as RequireAnyRole
+// but requires the user to have all the given roles.
+func RequireAllRoles(conf *Configuration, roles []string) func(http.Handler) http.Handler {
+	return requireRoles(conf, roles, true)
+}
+
+func requireRoles(conf *Configuration, roles []string, all bool) func(http.Handler) http.Handler {
+	return userMiddleware(conf, func(u *User, r *http.Request) error {
+		return conf.validateRoles(u, roles, all)
+	})
+}
+
+// Roles returns the roles found in the claims with the given paths. The segments of a path are
+// separated by dots and the claims found can either be a string or an array of strings.
+// When no path is given the 'roles' claim is used.
+func (u *User) Roles(paths ...string) []string {
+	if len(paths) == 0 {
+		paths = []string{defaultRolesClaim}
+	}
+
+	var roles []string
+	for _, path := range paths {
+		switch v := claimAtPath(u.Claims, strings.Split(path, claimPathSeparator)).(type) {
+		case string:
+			roles = append(roles, v)
+		case []interface{}:
+			for _, r := range v {
+				if r, ok := r.(string); ok {
+					roles = append(roles, r)
+				}
+			}
+		}
+	}
+
+	return roles
+}
+
+// claimAtPath returns the claim found by following the segments of the path through the nested
+// claims. Keys containing the separator, such as client ids, are matched by trying the longest
+// keys first.
+func claimAtPath(claims map[string]interface{}, segments []string) interface{} {
+	for i := len(segments); i > 0; i-- {
+		v, ok := claims[strings.Join(segments[:i], claimPathSeparator)]
+		if !ok {
+			continue
+		}
+
+		if i == len(segments) {
+			return v
+		}
+
+		if nested, ok := v.(map[string]interface{}); ok {
+			if c := claimAtPath(nested, segments[i:]); c != nil {
+				return c
+			}
+		}
+	}
+
+	return nil
+}
+
+// rolesClaimsFor returns the RolesClaims of the provider with the given issuer.
+func (c *Configuration) rolesClaimsFor(iss string) ([]string, error) {
+	if c.provGetter == nil {
+		return nil, nil
+	}
+
+	provs, err := c.provGetter.get()
+	if err != nil {
+		return nil, err
+	}
+
+	if p := providers(provs).find(iss); p != nil {
+		return p.RolesClaims, nil
+	}
+
+	return nil, nil
+}
+
+// validateRoles rejects the requests without a User, even when no role is required.
+func (c *Configuration) validateRoles(u *User, required []string, all bool) error {
+	if u != nil {
+		paths, err := c.rolesClaimsFor(u.Issuer)
+		if err != nil {
+			return err
+		}
+
+		if grantsRequired(u.Roles(paths...), required, all) {
+			return nil
+		}
+	}
+
+	qualifier := "all"
+	if !all {
+		qualifier = "one"
+	}
+
+	return &AuthorizationError{
+		Code:       AuthorizationErrorMissingRole,
+		Message:    fmt.Sprintf("The user must have %v of the roles %v.", qualifier, required),
+		HTTPStatus: http.StatusForbidden,
+	}
+}
@@ -0,0 +1,109 @@
+package openid
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_User_Roles(t *testing.T) {
+	u := &User{Claims: map[string]interface{}{
+		"roles":  []interface{}{"admin", 42.0, "user"},
+		"groups": "staff",
+		"realm_access": map[string]interface{}{
+			"roles": []interface{}{"offline_access"},
+		},
+		"resource_access": map[string]interface{}{
+			"my.client": map[string]interface{}{
+				"roles": []interface{}{"editor"},
+			},
+		},
+	}}
+
+	assert.Equal(t, []string{"admin", "user"}, u.Roles())
+	assert.Equal(t, []string{"staff"}, u.Roles("groups"))
+	assert.Equal(t, []string{"offline_access"}, u.Roles("realm_access.roles"))
+	assert.Equal(t, []string{"editor"}, u.Roles("resource_access.my.client.roles"))
+	assert.Equal(t, []string{"offline_access", "staff"}, u.Roles("realm_access.roles", "groups"))
+	assert.Empty(t, u.Roles("resource_access.other.roles"))
+	assert.Empty(t, u.Roles("groups.name"))
+}
+
+func Test_validateRoles_UsesTheProviderRolesClaims(t *testing.T) {
+	c := &Configuration{provGetter: func() ([]Provider, error) {
+		return []Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}, RolesClaims: []string{"realm_access.roles"}}}, nil
+	}}
+
+	u := &User{Issuer: "https://issuer", Claims: map[string]interface{}{
+		"roles":        []interface{}{"admin"},
+		"realm_access": map[string]interface{}{"roles": []interface{}{"editor", "viewer"}},
+	}}
+
+	assert.Nil(t, c.validateRoles(u, []string{"editor", "viewer"}, true))
+	assert.Nil(t, c.validateRoles(u, []string{"admin", "viewer"}, false))
+
+	err := c.validateRoles(u, []string{"admin"}, false)
+	expectAuthorizationError(t, err, AuthorizationErrorMissingRole)
+
+	err = c.validateRoles(u, []string{"editor", "admin"}, true)
+	expectAuthorizationError(t, err, AuthorizationErrorMissingRole)
+
+	err = c.validateRoles(nil, []string{"editor"}, false)
+	expectAuthorizationError(t, err, AuthorizationErrorMissingRole)
+
+	err = c.validateRoles(nil, nil, true)
+	expectAuthorizationError(t, err, AuthorizationErrorMissingRole)
+}
+
+func Test_validateRoles_WhenProvidersGetterFails(t *testing.T) {
+	ee := errors.New("providers unavailable")
+	c := &Configuration{provGetter: func() ([]Provider, error) { return nil, ee }}
+
+	err := c.validateRoles(&User{Issuer: "https://issuer"}, []string{"admin"}, false)
+
+	assert.Equal(t, ee, err)
+}
+
+func Test_RequireAnyRole_WhenRoleIsMissing(t *testing.T) {
+	vm, c := createConfiguration(t, nil, getIDTokenReturnsSuccess)
+
+	jt := createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "SUB1", "roles": []interface{}{"user"}})
+
+	vm.On("validate", mock.Anything, idToken).Return(jt, nil)
+
+	h := Middleware(c)(RequireAnyRole(c, []string{"admin"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("The handler should not have been called.")
+	})))
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+	vm.AssertExpectations(t)
+}
+
+func Test_RequireAllRoles_WhenRolesAreGranted(t *testing.T) {
+	vm, c := createConfiguration(t, errorHandlerHalt, getIDTokenReturnsSuccess)
+
+	jt := createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "SUB1", "scope": "read", "roles": []interface{}{"user", "admin"}})
+
+	vm.On("validate", mock.Anything, idToken).Return(jt, nil)
+
+	// The authorization middlewares are stacked after the authentication.
+	called := false
+	h := Middleware(c)(RequireAnyScope(c, []string{"read"})(RequireAllRoles(c, []string{"admin", "user"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, called = UserFromContext(r.Context())
+	}))))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !called {
+		t.Error("The handler should have been called with the user.")
+	}
+
+	vm.AssertExpectations(t)
+}
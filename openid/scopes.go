@@ -0,0 +1,103 @@
+package openid
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const scopeClaimName = "scope"
+const scpClaimName = "scp"
+
+// RequireAllScopes returns a middleware that verifies that the token of the User stored in the
+// request context was granted all the given scopes before calling the next handler. It must be
+// stacked after Authenticate, AuthenticateUser or Middleware, the requests without a User are
+// rejected.
+// When a scope is missing the error is handled by the ErrorHandlerFunc as an *AuthorizationError
+// with the code AuthorizationErrorInsufficientScope. The default behavior stops the execution
+// and returns Forbidden with an RFC 6750 'insufficient_scope' challenge.
+func RequireAllScopes(conf *Configuration, scopes []string) func(http.Handler) http.Handler {
+	return requireScopes(conf, scopes, true)
+}
+
+// RequireAnyScope returns a middleware that performs the same verification as RequireAllScopes
+// but only requires the token to be granted one of the given scopes.
+func RequireAnyScope(conf *Configuration, scopes []string) func(http.Handler) http.Handler {
+	return requireScopes(conf, scopes, false)
+}
+
+func requireScopes(conf *Configuration, scopes []string, all bool) func(http.Handler) http.Handler {
+	return userMiddleware(conf, func(u *User, r *http.Request) error {
+		return validateScopes(u, scopes, all)
+	})
+}
+
+// Scopes returns the scopes granted to the token, found in its 'scope' claim or, when it does
+// not have one, in its 'scp' claim. Both the space delimited string and the array forms of the
+// claims are supported.
+func (u *User) Scopes() []string {
+	if s := scopesFromClaim(u.Claims[scopeClaimName]); s != nil {
+		return s
+	}
+
+	return scopesFromClaim(u.Claims[scpClaimName])
+}
+
+func scopesFromClaim(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var scopes []string
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				scopes = append(scopes, strings.Fields(s)...)
+			}
+		}
+		return scopes
+	case []string:
+		return v
+	}
+
+	return nil
+}
+
+// validateScopes rejects the requests without a User, even when no scope is required.
+func validateScopes(u *User, required []string, all bool) error {
+	if u != nil && grantsRequired(u.Scopes(), required, all) {
+		return nil
+	}
+
+	qualifier := "all"
+	if !all {
+		qualifier = "one"
+	}
+
+	return &AuthorizationError{
+		Code:       AuthorizationErrorInsufficientScope,
+		Message:    fmt.Sprintf("The token must be granted %v of the scopes %v.", qualifier, required),
+		HTTPStatus: http.StatusForbidden,
+		Challenge:  fmt.Sprintf(`Bearer error="insufficient_scope", scope="%v"`, strings.Join(required, " ")),
+	}
+}
+
+// grantsRequired returns whether the granted values contain all or, when all is false, one of
+// the required values. It returns true when no value is required.
+func grantsRequired(granted []string, required []string, all bool) bool {
+	if len(required) == 0 {
+		return true
+	}
+
+	set := make(map[string]bool, len(granted))
+	for _, g := range granted {
+		set[g] = true
+	}
+
+	for _, r := range required {
+		if set[r] != all {
+			return !all
+		}
+	}
+
+	return all
+}
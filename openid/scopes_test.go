@@ -0,0 +1,113 @@
+package openid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_User_Scopes(t *testing.T) {
+	for _, claims := range []map[string]interface{}{
+		{"scope": " read  write "},
+		{"scope": []interface{}{"read", "write"}},
+		{"scp": "read write"},
+		{"scp": []interface{}{"read", "write", 42.0}},
+		{"scope": "read write", "scp": "admin"},
+	} {
+		u := &User{Claims: claims}
+		assert.Equal(t, []string{"read", "write"}, u.Scopes(), "%v", claims)
+	}
+
+	u := &User{Claims: map[string]interface{}{}}
+	assert.Empty(t, u.Scopes())
+}
+
+func Test_validateScopes(t *testing.T) {
+	u := &User{Claims: map[string]interface{}{"scope": "read write"}}
+
+	assert.Nil(t, validateScopes(u, []string{"read", "write"}, true))
+	assert.Nil(t, validateScopes(u, []string{"admin", "write"}, false))
+	assert.Nil(t, validateScopes(u, nil, true))
+
+	err := validateScopes(u, []string{"read", "admin"}, true)
+	expectAuthorizationError(t, err, AuthorizationErrorInsufficientScope)
+
+	err = validateScopes(u, []string{"admin", "delete"}, false)
+	expectAuthorizationError(t, err, AuthorizationErrorInsufficientScope)
+
+	err = validateScopes(nil, []string{"read"}, false)
+	expectAuthorizationError(t, err, AuthorizationErrorInsufficientScope)
+
+	err = validateScopes(nil, nil, true)
+	expectAuthorizationError(t, err, AuthorizationErrorInsufficientScope)
+}
+
+func Test_RequireAllScopes_WhenScopeIsMissing(t *testing.T) {
+	vm, c := createConfiguration(t, nil, getIDTokenReturnsSuccess)
+
+	jt := createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "SUB1", "scp": []interface{}{"read"}})
+
+	vm.On("validate", mock.Anything, idToken).Return(jt, nil)
+
+	h := Middleware(c)(RequireAllScopes(c, []string{"read", "write"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("The handler should not have been called.")
+	})))
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+	assert.Equal(t, `Bearer error="insufficient_scope", scope="read write"`, rw.Header().Get("WWW-Authenticate"))
+	vm.AssertExpectations(t)
+}
+
+func Test_RequireAnyScope_WhenScopeIsGranted(t *testing.T) {
+	vm, c := createConfiguration(t, errorHandlerHalt, getIDTokenReturnsSuccess)
+
+	jt := createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "SUB1", "scope": "write"})
+
+	vm.On("validate", mock.Anything, idToken).Return(jt, nil)
+
+	called := false
+	h := Middleware(c)(RequireAnyScope(c, []string{"read", "write"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, called = UserFromContext(r.Context())
+	})))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !called {
+		t.Error("The handler should have been called.")
+	}
+
+	vm.AssertExpectations(t)
+}
+
+func Test_RequireAnyScope_WhenUserIsNotInContext(t *testing.T) {
+	_, c := createConfiguration(t, nil, nil)
+
+	h := RequireAnyScope(c, []string{"read"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("The handler should not have been called.")
+	}))
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+}
+
+func expectAuthorizationError(t *testing.T, e error, c AuthorizationErrorCode) {
+	if ae, ok := e.(*AuthorizationError); ok {
+		if ae.Code != c {
+			t.Error("Expected error code", c, "but was", ae.Code)
+		}
+
+		if ae.HTTPStatus != http.StatusForbidden {
+			t.Error("Expected HTTP status", http.StatusForbidden, "but was", ae.HTTPStatus)
+		}
+	} else {
+		t.Errorf("Expected error type *AuthorizationError but was %T", e)
+	}
+}
@@ -13,14 +13,21 @@ type signingKeyGetter interface {
 type signingKeyProvider struct {
 	keySetGetter signingKeySetGetter
 	jwksMap      map[string][]signingKey
+	staleJwksMap map[string][]signingKey
 }
 
 func newSigningKeyProvider(kg signingKeySetGetter) *signingKeyProvider {
 	keyMap := make(map[string][]signingKey)
-	return &signingKeyProvider{kg, keyMap}
+	staleKeyMap := make(map[string][]signingKey)
+	return &signingKeyProvider{kg, keyMap, staleKeyMap}
 }
 
 func (s *signingKeyProvider) flushCachedSigningKeys(issuer string) error {
+	// The flushed keys are kept aside so they can still be used while the provider circuit is open.
+	if skeys, ok := s.jwksMap[issuer]; ok {
+		s.staleJwksMap[issuer] = skeys
+	}
+
 	delete(s.jwksMap, issuer)
 	return nil
 }
@@ -29,13 +36,24 @@ func (s *signingKeyProvider) refreshSigningKeys(r *http.Request, issuer string)
 	skeys, err := s.keySetGetter.get(r, issuer)
 
 	if err != nil {
+		if skeys, ok := s.staleJwksMap[issuer]; ok && isCircuitOpen(err) {
+			s.jwksMap[issuer] = skeys
+			return nil
+		}
+
 		return err
 	}
 
 	s.jwksMap[issuer] = skeys
+	delete(s.staleJwksMap, issuer)
 	return nil
 }
 
+func isCircuitOpen(err error) bool {
+	verr, ok := err.(*ValidationError)
+	return ok && verr.Code == ValidationErrorCircuitOpen
+}
+
 func (s *signingKeyProvider) getSigningKey(r *http.Request, issuer string, kid string) ([]byte, error) {
 	sk := findKey(s.jwksMap, issuer, kid)
 
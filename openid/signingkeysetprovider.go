@@ -3,6 +3,7 @@ package openid
 import (
 	"fmt"
 	"net/http"
+	"sync"
 )
 
 type signingKeySetGetter interface {
@@ -10,9 +11,14 @@ type signingKeySetGetter interface {
 }
 
 type signingKeySetProvider struct {
-	configGetter configurationGetter
-	jwksGetter   jwksGetter
-	keyEncoder   pemEncoder
+	configGetter  configurationGetter
+	jwksGetter    jwksGetter
+	keyEncoder    pemEncoder
+	provGetter    providersGetter
+	jwksValidator *jwksURIValidator
+
+	mu            sync.Mutex
+	lastEndpoints map[string]string
 }
 
 type signingKey struct {
@@ -21,16 +27,77 @@ type signingKey struct {
 }
 
 func newSigningKeySetProvider(cg configurationGetter, jg jwksGetter, ke pemEncoder) *signingKeySetProvider {
-	return &signingKeySetProvider{cg, jg, ke}
+	return &signingKeySetProvider{configGetter: cg, jwksGetter: jg, keyEncoder: ke}
 }
 
 func (signProv *signingKeySetProvider) get(r *http.Request, iss string) ([]signingKey, error) {
-	conf, err := signProv.configGetter.get(r, iss)
+	p := signProv.provider(iss)
+	endpoints := signProv.endpoints(p, iss)
+
+	var err error
+	for _, endpoint := range endpoints {
+		var sk []signingKey
+		if sk, err = signProv.getFromEndpoint(r, p, iss, endpoint); err == nil {
+			signProv.setLastEndpoint(iss, endpoint)
+			return sk, nil
+		}
+	}
+
+	return nil, err
+}
+
+// getConfiguration returns the configuration of the OP with the given issuer, retrieved from its
+// metadata endpoints like the signing keys are.
+func (signProv *signingKeySetProvider) getConfiguration(r *http.Request, iss string) (configuration, error) {
+	endpoints := signProv.endpoints(signProv.provider(iss), iss)
+
+	var err error
+	for _, endpoint := range endpoints {
+		var conf configuration
+		if conf, err = signProv.configurationFromEndpoint(r, iss, endpoint); err == nil {
+			signProv.setLastEndpoint(iss, endpoint)
+			return conf, nil
+		}
+	}
+
+	return configuration{}, err
+}
+
+func (signProv *signingKeySetProvider) configurationFromEndpoint(r *http.Request, iss string, endpoint string) (configuration, error) {
+	conf, err := signProv.configGetter.get(r, endpoint)
+
+	if err != nil {
+		return configuration{}, err
+	}
+
+	// The configuration must be the one of the expected OP, whichever endpoint it was retrieved from.
+	// See OpenID Connect Discovery section 4.3.
+	if !configurationIssuerMatches(conf.Issuer, iss) {
+		return configuration{}, &ValidationError{
+			Code:       ValidationErrorInvalidConfigurationIssuer,
+			Message:    fmt.Sprintf("The configuration retrieved from the endpoint %v is the one of the issuer %v and not %v.", endpoint, conf.Issuer, iss),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	return conf, nil
+}
+
+func (signProv *signingKeySetProvider) getFromEndpoint(r *http.Request, p *Provider, iss string, endpoint string) ([]signingKey, error) {
+	conf, err := signProv.configurationFromEndpoint(r, iss, endpoint)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if signProv.jwksValidator != nil {
+		if err := signProv.jwksValidator.validate(p, iss, endpoint, conf.JwksURI); err != nil {
+			return nil, err
+		}
+
+		r = withJwksLocation(r, p, iss, endpoint)
+	}
+
 	jwks, err := signProv.jwksGetter.get(r, conf.JwksURI)
 
 	if err != nil {
@@ -58,3 +125,65 @@ func (signProv *signingKeySetProvider) get(r *http.Request, iss string) ([]signi
 
 	return sk, nil
 }
+
+// configurationIssuerMatches returns true if the issuer of the OP configuration is the issuer of
+// the token, accounting for the tokens issued by google whose issuer does not have a scheme.
+func configurationIssuerMatches(confIss string, iss string) bool {
+	if iss == "accounts.google.com" {
+		iss = "https://" + iss
+	}
+
+	return confIss == iss
+}
+
+// provider returns the registered provider with the given issuer or nil if it can not be found.
+func (signProv *signingKeySetProvider) provider(iss string) *Provider {
+	if signProv.provGetter == nil {
+		return nil
+	}
+
+	provs, err := signProv.provGetter.get()
+	if err != nil {
+		return nil
+	}
+
+	return providers(provs).find(iss)
+}
+
+// endpoints returns the metadata endpoints of the given provider starting with the one
+// that succeeded last.
+func (signProv *signingKeySetProvider) endpoints(p *Provider, iss string) []string {
+	endpoints := []string{iss}
+	if p != nil && len(p.MetadataEndpoints) > 0 {
+		endpoints = p.MetadataEndpoints
+	}
+
+	last := signProv.lastEndpoint(iss)
+	for i, e := range endpoints {
+		if e == last && i > 0 {
+			ordered := make([]string, 0, len(endpoints))
+			ordered = append(ordered, endpoints[i:]...)
+			return append(ordered, endpoints[:i]...)
+		}
+	}
+
+	return endpoints
+}
+
+func (signProv *signingKeySetProvider) lastEndpoint(iss string) string {
+	signProv.mu.Lock()
+	defer signProv.mu.Unlock()
+
+	return signProv.lastEndpoints[iss]
+}
+
+func (signProv *signingKeySetProvider) setLastEndpoint(iss string, endpoint string) {
+	signProv.mu.Lock()
+	defer signProv.mu.Unlock()
+
+	if signProv.lastEndpoints == nil {
+		signProv.lastEndpoints = make(map[string]string)
+	}
+
+	signProv.lastEndpoints[iss] = endpoint
+}
@@ -35,7 +35,7 @@ func TestSigningKeySetProvider_Get_WhenGetJwksReturnsError(t *testing.T) {
 
 	jwksGetter.On("get", req, mock.Anything).Return(jose.JSONWebKeySet{}, ee)
 
-	configGetter.On("get", mock.Anything).Return(configuration{}, nil)
+	configGetter.On("get", mock.Anything).Return(configuration{Issuer: mock.Anything}, nil)
 
 	sk, re := skProv.get(req, mock.Anything)
 
@@ -55,7 +55,7 @@ func TestSigningKeySetProvider_Get_WhenJwkSetIsEmpty(t *testing.T) {
 	ee := &ValidationError{Code: ValidationErrorEmptyJwk, HTTPStatus: http.StatusUnauthorized}
 
 	jwksGetter.On("get", (*http.Request)(nil), mock.Anything).Return(jose.JSONWebKeySet{}, nil)
-	configGetter.On("get", mock.Anything).Return(configuration{}, nil)
+	configGetter.On("get", mock.Anything).Return(configuration{Issuer: mock.Anything}, nil)
 
 	sk, re := skProv.get(nil, mock.Anything)
 
@@ -76,7 +76,7 @@ func TestSigningKeySetProvider_Get_WhenKeyEncodingReturnsError(t *testing.T) {
 	ejwks := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: nil}}}
 
 	jwksGetter.On("get", (*http.Request)(nil), mock.Anything).Return(ejwks, nil)
-	configGetter.On("get", mock.Anything).Return(configuration{}, nil)
+	configGetter.On("get", mock.Anything).Return(configuration{Issuer: mock.Anything}, nil)
 	pemEncoder.On("encode", nil).Return(nil, ee)
 
 	sk, re := skProv.get(nil, mock.Anything)
@@ -107,7 +107,7 @@ func TestSigningKeySetProvider_Get_WhenKeyEncodingReturnsSuccess(t *testing.T) {
 	ejwks := jose.JSONWebKeySet{Keys: keys}
 
 	jwksGetter.On("get", req, mock.Anything).Return(ejwks, nil)
-	configGetter.On("get", mock.Anything).Return(configuration{}, nil)
+	configGetter.On("get", mock.Anything).Return(configuration{Issuer: mock.Anything}, nil)
 
 	for i, encryptedKey := range encryptedKeys {
 		pemEncoder.On("encode", keys[i].Key).Return(encryptedKey.key, nil)
@@ -141,11 +141,147 @@ func TestSigningKeySetProvider_Get_WhenKeyEncodingReturnsSuccess(t *testing.T) {
 	pemEncoder.AssertExpectations(t)
 }
 
-func createSigningKeySetProvider(t *testing.T) (*mockConfigurationGetter, *mockJwksGetter, *mockPemEncoder, signingKeySetProvider) {
+func TestSigningKeySetProvider_Get_WhenFirstEndpointFails_FailsOver(t *testing.T) {
+	configGetter, jwksGetter, pemEncoder, skProv := createSigningKeySetProvider(t)
+	pm := &mockProvidersGetter{}
+	skProv.provGetter = pm
+
+	iss := "https://issuer"
+	primary := "https://primary.issuer"
+	secondary := "https://secondary.issuer"
+	pm.On("get").Return([]Provider{{Issuer: iss, ClientIDs: []string{"client"}, MetadataEndpoints: []string{primary, secondary}}}, nil)
+
+	ee := &ValidationError{Code: ValidationErrorGetOpenIdConfigurationFailure, HTTPStatus: http.StatusUnauthorized}
+	configGetter.On("get", (*http.Request)(nil), primary).Return(configuration{}, ee).Once()
+	configGetter.On("get", (*http.Request)(nil), secondary).Return(configuration{Issuer: iss, JwksURI: secondary + "/jwks"}, nil).Twice()
+
+	ejwks := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{KeyID: "kid", Key: "key"}}}
+	jwksGetter.On("get", (*http.Request)(nil), secondary+"/jwks").Return(ejwks, nil).Twice()
+	pemEncoder.On("encode", "key").Return([]byte("key"), nil).Twice()
+
+	sk, re := skProv.get(nil, iss)
+
+	if re != nil {
+		t.Error("An error was returned but not expected.", re)
+	}
+
+	if len(sk) != 1 || sk[0].keyID != "kid" {
+		t.Error("Expected the key from the secondary endpoint, but got", sk)
+	}
+
+	// The last successful endpoint is tried first next time.
+	sk, re = skProv.get(nil, iss)
+
+	if re != nil {
+		t.Error("An error was returned but not expected.", re)
+	}
+
+	if len(sk) != 1 {
+		t.Error("Expected the key from the secondary endpoint, but got", sk)
+	}
+
+	configGetter.AssertExpectations(t)
+	jwksGetter.AssertExpectations(t)
+	pemEncoder.AssertExpectations(t)
+}
+
+func TestSigningKeySetProvider_Get_WhenAllEndpointsFail(t *testing.T) {
+	configGetter, _, _, skProv := createSigningKeySetProvider(t)
+	pm := &mockProvidersGetter{}
+	skProv.provGetter = pm
+
+	iss := "https://issuer"
+	pm.On("get").Return([]Provider{{Issuer: iss, ClientIDs: []string{"client"}, MetadataEndpoints: []string{"https://a", "https://b"}}}, nil)
+
+	ee := &ValidationError{Code: ValidationErrorGetOpenIdConfigurationFailure, HTTPStatus: http.StatusUnauthorized}
+	configGetter.On("get", (*http.Request)(nil), "https://a").Return(configuration{}, ee).Once()
+	configGetter.On("get", (*http.Request)(nil), "https://b").Return(configuration{}, ee).Once()
+
+	sk, re := skProv.get(nil, iss)
+
+	expectValidationError(t, re, ee.Code, ee.HTTPStatus, nil)
+
+	if sk != nil {
+		t.Error("The returned signing keys should be nil")
+	}
+
+	configGetter.AssertExpectations(t)
+}
+
+func TestSigningKeySetProvider_Get_WhenConfigurationIssuerDoesNotMatch(t *testing.T) {
+	configGetter, jwksGetter, _, skProv := createSigningKeySetProvider(t)
+	pm := &mockProvidersGetter{}
+	skProv.provGetter = pm
+
+	iss := "https://issuer"
+	pm.On("get").Return([]Provider{{Issuer: iss, ClientIDs: []string{"client"}, MetadataEndpoints: []string{"https://mirror.issuer"}}}, nil)
+	configGetter.On("get", (*http.Request)(nil), "https://mirror.issuer").Return(configuration{Issuer: "https://attacker", JwksURI: "https://attacker/jwks"}, nil)
+
+	sk, re := skProv.get(nil, iss)
+
+	expectValidationError(t, re, ValidationErrorInvalidConfigurationIssuer, http.StatusUnauthorized, nil)
+
+	if sk != nil {
+		t.Error("The returned signing keys should be nil")
+	}
+
+	configGetter.AssertExpectations(t)
+	jwksGetter.AssertNotCalled(t, "get", mock.Anything, mock.Anything)
+}
+
+func TestSigningKeySetProvider_GetConfiguration_WhenFirstEndpointFails_FailsOver(t *testing.T) {
+	configGetter, _, _, skProv := createSigningKeySetProvider(t)
+	pm := &mockProvidersGetter{}
+	skProv.provGetter = pm
+
+	iss := "https://issuer"
+	pm.On("get").Return([]Provider{{Issuer: iss, ClientIDs: []string{"client"}, MetadataEndpoints: []string{"https://a", "https://b"}}}, nil)
+
+	ee := &ValidationError{Code: ValidationErrorGetOpenIdConfigurationFailure, HTTPStatus: http.StatusUnauthorized}
+	configGetter.On("get", (*http.Request)(nil), "https://a").Return(configuration{}, ee).Once()
+	configGetter.On("get", (*http.Request)(nil), "https://b").Return(configuration{Issuer: iss, IntrospectionEndpoint: "https://b/introspect"}, nil).Twice()
+
+	for i := 0; i < 2; i++ {
+		conf, err := skProv.getConfiguration(nil, iss)
+
+		if err != nil {
+			t.Error("An error was returned but not expected.", err)
+		}
+
+		if conf.IntrospectionEndpoint != "https://b/introspect" {
+			t.Error("Expected the configuration from the second endpoint, but got", conf)
+		}
+	}
+
+	configGetter.AssertExpectations(t)
+}
+
+func TestSigningKeySetProvider_GetConfiguration_WhenConfigurationIssuerDoesNotMatch(t *testing.T) {
+	configGetter, _, _, skProv := createSigningKeySetProvider(t)
+
+	iss := "https://issuer"
+	configGetter.On("get", (*http.Request)(nil), iss).Return(configuration{Issuer: "https://attacker"}, nil)
+
+	_, err := skProv.getConfiguration(nil, iss)
+
+	expectValidationError(t, err, ValidationErrorInvalidConfigurationIssuer, http.StatusUnauthorized, nil)
+}
+
+func Test_configurationIssuerMatches(t *testing.T) {
+	if !configurationIssuerMatches("https://accounts.google.com", "accounts.google.com") {
+		t.Error("The configuration of google should match the tokens issued without scheme.")
+	}
+
+	if configurationIssuerMatches("https://issuer/", "https://issuer") {
+		t.Error("The issuers should be compared exactly.")
+	}
+}
+
+func createSigningKeySetProvider(t *testing.T) (*mockConfigurationGetter, *mockJwksGetter, *mockPemEncoder, *signingKeySetProvider) {
 	configGetter := &mockConfigurationGetter{}
 	jwksGetter := &mockJwksGetter{}
 	pemEncoder := &mockPemEncoder{}
 
-	skProv := signingKeySetProvider{configGetter: configGetter, jwksGetter: jwksGetter, keyEncoder: pemEncoder}
+	skProv := &signingKeySetProvider{configGetter: configGetter, jwksGetter: jwksGetter, keyEncoder: pemEncoder}
 	return configGetter, jwksGetter, pemEncoder, skProv
 }
@@ -0,0 +1,180 @@
+package openid
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const languageTagSeparator = "#"
+
+// StandardClaims represents the standard claims about the end-user described in the section 5.1
+// of the OpenID Connect Core specification. The fields are empty when the corresponding claim is
+// not present in the token or has an unexpected type.
+//
+// The decoding is lenient: booleans sent as the strings "true" or "false" and NumericDates sent as
+// strings are accepted, and an address sent as a JSON encoded string is decoded.
+//
+// The Localized contains the language-tagged variants of the claims, such as 'name#ja-Kana-JP',
+// indexed by the claim name and then by the language tag, see the section 5.2 of the specification.
+type StandardClaims struct {
+	Name                string
+	GivenName           string
+	FamilyName          string
+	MiddleName          string
+	Nickname            string
+	PreferredUsername   string
+	Profile             string
+	Picture             string
+	Website             string
+	Email               string
+	EmailVerified       bool
+	Gender              string
+	Birthdate           string
+	Zoneinfo            string
+	Locale              string
+	PhoneNumber         string
+	PhoneNumberVerified bool
+	Address             *Address
+	UpdatedAt           time.Time
+	Localized           map[string]map[string]string
+}
+
+// Address represents the 'address' claim described in the section 5.1.1 of the OpenID Connect
+// Core specification.
+type Address struct {
+	Formatted     string `json:"formatted"`
+	StreetAddress string `json:"street_address"`
+	Locality      string `json:"locality"`
+	Region        string `json:"region"`
+	PostalCode    string `json:"postal_code"`
+	Country       string `json:"country"`
+}
+
+// LocalizedClaim returns the variant of the claim with the given name tagged with the given
+// language, for instance LocalizedClaim("name", "ja-Kana-JP"). When the claim has no variant for
+// that language the claim without language tag is returned.
+func (sc StandardClaims) LocalizedClaim(name string, lang string) string {
+	for tag, v := range sc.Localized[name] {
+		if strings.EqualFold(tag, lang) {
+			return v
+		}
+	}
+
+	switch name {
+	case "name":
+		return sc.Name
+	case "given_name":
+		return sc.GivenName
+	case "family_name":
+		return sc.FamilyName
+	case "middle_name":
+		return sc.MiddleName
+	case "nickname":
+		return sc.Nickname
+	case "profile":
+		return sc.Profile
+	case "picture":
+		return sc.Picture
+	case "website":
+		return sc.Website
+	}
+
+	return ""
+}
+
+func newStandardClaims(claims map[string]interface{}) StandardClaims {
+	sc := StandardClaims{
+		Name:                stringClaim(claims, "name"),
+		GivenName:           stringClaim(claims, "given_name"),
+		FamilyName:          stringClaim(claims, "family_name"),
+		MiddleName:          stringClaim(claims, "middle_name"),
+		Nickname:            stringClaim(claims, "nickname"),
+		PreferredUsername:   stringClaim(claims, "preferred_username"),
+		Profile:             stringClaim(claims, "profile"),
+		Picture:             stringClaim(claims, "picture"),
+		Website:             stringClaim(claims, "website"),
+		Email:               stringClaim(claims, "email"),
+		EmailVerified:       boolClaim(claims, "email_verified"),
+		Gender:              stringClaim(claims, "gender"),
+		Birthdate:           stringClaim(claims, "birthdate"),
+		Zoneinfo:            stringClaim(claims, "zoneinfo"),
+		Locale:              stringClaim(claims, "locale"),
+		PhoneNumber:         stringClaim(claims, "phone_number"),
+		PhoneNumberVerified: boolClaim(claims, "phone_number_verified"),
+		Address:             addressClaim(claims, "address"),
+	}
+
+	if s, ok := claims["updated_at"].(string); ok {
+		if secs, err := strconv.ParseFloat(s, 64); err == nil {
+			if t, ok := secondsToTime(secs); ok {
+				sc.UpdatedAt = t
+			}
+		}
+	} else if t, ok, _ := getTimeClaim(claims, "updated_at"); ok {
+		sc.UpdatedAt = t
+	}
+
+	for k, v := range claims {
+		i := strings.Index(k, languageTagSeparator)
+		if i <= 0 || i == len(k)-1 {
+			continue
+		}
+
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+
+		if sc.Localized == nil {
+			sc.Localized = make(map[string]map[string]string)
+		}
+
+		name, tag := k[:i], k[i+1:]
+		if sc.Localized[name] == nil {
+			sc.Localized[name] = make(map[string]string)
+		}
+
+		sc.Localized[name][tag] = s
+	}
+
+	return sc
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// boolClaim returns the value of the boolean claim, accepting the strings "true" and "false" sent
+// by some OPs. Any other value is false.
+func boolClaim(claims map[string]interface{}, name string) bool {
+	switch v := claims[name].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+
+	return false
+}
+
+func addressClaim(claims map[string]interface{}, name string) *Address {
+	var b []byte
+	switch v := claims[name].(type) {
+	case map[string]interface{}:
+		b, _ = json.Marshal(v)
+	case string:
+		b = []byte(v)
+	default:
+		return nil
+	}
+
+	a := new(Address)
+	if err := json.Unmarshal(b, a); err != nil {
+		return nil
+	}
+
+	return a
+}
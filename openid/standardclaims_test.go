@@ -0,0 +1,127 @@
+package openid
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newStandardClaims_DecodesStandardClaims(t *testing.T) {
+	claims := map[string]interface{}{
+		"name":                  "Jane Doe",
+		"given_name":            "Jane",
+		"family_name":           "Doe",
+		"preferred_username":    "j.doe",
+		"picture":               "http://example.com/janedoe/me.jpg",
+		"email":                 "janedoe@example.com",
+		"email_verified":        true,
+		"locale":                "en-US",
+		"phone_number":          "+1 (425) 555-1212",
+		"phone_number_verified": false,
+		"updated_at":            float64(1311280970),
+		"address": map[string]interface{}{
+			"street_address": "1234 Hollywood Blvd.",
+			"locality":       "Los Angeles",
+			"country":        "US",
+		},
+	}
+
+	sc := newStandardClaims(claims)
+
+	assert.Equal(t, "Jane Doe", sc.Name)
+	assert.Equal(t, "Jane", sc.GivenName)
+	assert.Equal(t, "Doe", sc.FamilyName)
+	assert.Equal(t, "j.doe", sc.PreferredUsername)
+	assert.Equal(t, "http://example.com/janedoe/me.jpg", sc.Picture)
+	assert.Equal(t, "janedoe@example.com", sc.Email)
+	assert.True(t, sc.EmailVerified)
+	assert.Equal(t, "en-US", sc.Locale)
+	assert.Equal(t, "+1 (425) 555-1212", sc.PhoneNumber)
+	assert.False(t, sc.PhoneNumberVerified)
+	assert.Equal(t, time.Unix(1311280970, 0), sc.UpdatedAt)
+	assert.Equal(t, &Address{StreetAddress: "1234 Hollywood Blvd.", Locality: "Los Angeles", Country: "US"}, sc.Address)
+	assert.Nil(t, sc.Localized)
+}
+
+func Test_newStandardClaims_DecodesLeniently(t *testing.T) {
+	claims := map[string]interface{}{
+		"email_verified":        "true",
+		"phone_number_verified": "true",
+		"updated_at":            "1311280970",
+		"address":               `{"formatted":"1234 Hollywood Blvd."}`,
+		"name":                  42.0,
+	}
+
+	sc := newStandardClaims(claims)
+
+	assert.True(t, sc.EmailVerified)
+	assert.True(t, sc.PhoneNumberVerified)
+	assert.Equal(t, time.Unix(1311280970, 0), sc.UpdatedAt)
+	assert.Equal(t, &Address{Formatted: "1234 Hollywood Blvd."}, sc.Address)
+	assert.Empty(t, sc.Name)
+}
+
+func Test_newStandardClaims_WhenUpdatedAtIsStringAfterYear2262(t *testing.T) {
+	updated := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	sc := newStandardClaims(map[string]interface{}{"updated_at": strconv.FormatInt(updated.Unix(), 10)})
+	assert.True(t, updated.Equal(sc.UpdatedAt), "Expected %v but got %v", updated, sc.UpdatedAt)
+
+	sc = newStandardClaims(map[string]interface{}{"updated_at": "1e19"})
+	assert.True(t, sc.UpdatedAt.IsZero())
+}
+
+func Test_newStandardClaims_WhenUpdatedAtIsJSONNumber(t *testing.T) {
+	sc := newStandardClaims(map[string]interface{}{"updated_at": json.Number("1311280970")})
+
+	assert.Equal(t, time.Unix(1311280970, 0), sc.UpdatedAt)
+}
+
+func Test_newStandardClaims_WhenValuesAreInvalid(t *testing.T) {
+	claims := map[string]interface{}{
+		"email_verified": "yes",
+		"updated_at":     "yesterday",
+		"address":        "1234 Hollywood Blvd.",
+	}
+
+	sc := newStandardClaims(claims)
+
+	assert.False(t, sc.EmailVerified)
+	assert.True(t, sc.UpdatedAt.IsZero())
+	assert.Nil(t, sc.Address)
+}
+
+func Test_boolClaim_AcceptsOnlyTrueAndFalse(t *testing.T) {
+	for _, v := range []string{"1", "t", "T", "TRUE", "True", " true"} {
+		assert.False(t, boolClaim(map[string]interface{}{"email_verified": v}, "email_verified"), v)
+	}
+
+	assert.True(t, boolClaim(map[string]interface{}{"email_verified": "true"}, "email_verified"))
+	assert.False(t, boolClaim(map[string]interface{}{"email_verified": "false"}, "email_verified"))
+}
+
+func Test_newStandardClaims_DecodesLanguageTaggedClaims(t *testing.T) {
+	claims := map[string]interface{}{
+		"name":                   "Jane Doe",
+		"family_name#ja-Kana-JP": "ドウ",
+		"name#ja-Hani-JP":        "ジェーン・ドウ",
+		"name#fr":                "Jeanne Doe",
+		"#fr":                    "ignored",
+		"nickname#":              "ignored",
+	}
+
+	sc := newStandardClaims(claims)
+
+	assert.Equal(t, map[string]map[string]string{
+		"name":        {"ja-Hani-JP": "ジェーン・ドウ", "fr": "Jeanne Doe"},
+		"family_name": {"ja-Kana-JP": "ドウ"},
+	}, sc.Localized)
+
+	assert.Equal(t, "Jeanne Doe", sc.LocalizedClaim("name", "FR"))
+	assert.Equal(t, "Jane Doe", sc.LocalizedClaim("name", "de"))
+	assert.Equal(t, "ドウ", sc.LocalizedClaim("family_name", "ja-Kana-JP"))
+	assert.Empty(t, sc.LocalizedClaim("given_name", "fr"))
+}
@@ -0,0 +1,129 @@
+package openid
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const authorizedPartyClaimName = "azp"
+const algorithmJwtHeaderName = "alg"
+
+// defaultSigningAlgorithm is the algorithm ID Tokens must be signed with, in strict validation,
+// when the provider does not register any, see OpenID Connect Dynamic Client Registration
+// 'id_token_signed_response_alg'.
+const defaultSigningAlgorithm = "RS256"
+
+// StrictValidation option enables the ID Token validation described in the section 3.1.3.7
+// of the OpenID Connect Core specification. In addition to the validation that is always performed,
+// i.e.: the 'iss', 'sub' and 'aud' claims are required and must match a registered provider:
+//
+//   - the 'exp' and 'iat' claims are required;
+//   - the 'azp' claim is required when the token has multiple audiences;
+//   - the 'azp' claim, when present, must be one of the provider ClientIDs;
+//   - the token must be signed with one of the provider SigningAlgorithms, RS256 by default.
+//
+// When this option is not used those rules are not enforced.
+func StrictValidation() func(*Configuration) error {
+	return func(c *Configuration) error {
+		c.tokenValidator.(*idTokenValidator).strict = true
+		return nil
+	}
+}
+
+// validateStrict validates the rules enforced in strict validation that are not already
+// enforced by the regular validation.
+func (tv *idTokenValidator) validateStrict(jt *jwtToken, p *Provider) error {
+	if !tv.strict {
+		return nil
+	}
+
+	if err := validateSigningAlgorithm(jt, p); err != nil {
+		return err
+	}
+
+	claims := jt.Claims
+
+	if _, ok, err := getTimeClaim(claims, expirationClaimName); err != nil {
+		return err
+	} else if !ok {
+		return &ValidationError{
+			Code:       ValidationErrorExpirationNotFound,
+			Message:    "The token 'exp' claim was not found.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	if _, ok, err := getTimeClaim(claims, issuedAtClaimName); err != nil {
+		return err
+	} else if !ok {
+		return &ValidationError{
+			Code:       ValidationErrorIssuedAtNotFound,
+			Message:    "The token 'iat' claim was not found.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	return validateAuthorizedParty(jt, p)
+}
+
+func validateSigningAlgorithm(jt *jwtToken, p *Provider) error {
+	algs := []string{defaultSigningAlgorithm}
+	if p != nil && len(p.SigningAlgorithms) > 0 {
+		algs = p.SigningAlgorithms
+	}
+
+	alg, _ := jt.Header[algorithmJwtHeaderName].(string)
+	for _, a := range algs {
+		if a == alg {
+			return nil
+		}
+	}
+
+	return &ValidationError{
+		Code:       ValidationErrorInvalidSigningAlgorithm,
+		Message:    fmt.Sprintf("The token is signed with the algorithm %q, expected one of %v.", alg, algs),
+		HTTPStatus: http.StatusUnauthorized,
+	}
+}
+
+func validateAuthorizedParty(jt *jwtToken, p *Provider) error {
+	claims := jt.Claims
+	azpClaim, found := claims[authorizedPartyClaimName]
+
+	if !found {
+		if auds, ok := claims[audiencesClaimName].([]interface{}); ok && len(auds) > 1 {
+			return &ValidationError{
+				Code:       ValidationErrorAuthorizedPartyNotFound,
+				Message:    "The token has multiple audiences but the 'azp' claim was not found.",
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+
+		return nil
+	}
+
+	azp, ok := azpClaim.(string)
+	if !ok || azp == "" {
+		return &ValidationError{
+			Code:       ValidationErrorInvalidAuthorizedParty,
+			Message:    fmt.Sprintf("The token 'azp' claim is invalid: %v.", azpClaim),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	if p == nil {
+		return nil
+	}
+
+	for _, cID := range p.ClientIDs {
+		if cID == azp {
+			return nil
+		}
+	}
+
+	return &ValidationError{
+		Code:       ValidationErrorInvalidAuthorizedParty,
+		Message:    fmt.Sprintf("The token 'azp' claim %v is not a client id of the provider %v.", azp, p.Issuer),
+		HTTPStatus: http.StatusUnauthorized,
+	}
+}
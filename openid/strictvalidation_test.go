@@ -0,0 +1,137 @@
+package openid
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_validateStrict_WhenNotEnabled(t *testing.T) {
+	_, _, _, _, tv := createIDTokenValidator(t)
+
+	jt := createTokenWithClaims(jwtClaims{})
+	jt.Header["alg"] = "none"
+
+	if err := tv.validateStrict(jt, nil); err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+}
+
+func Test_validateStrict_WhenTokenIsValid(t *testing.T) {
+	tv := createStrictIDTokenValidator(t)
+	p := &Provider{Issuer: "https://issuer", ClientIDs: []string{"client"}}
+
+	jt := createStrictToken()
+
+	if err := tv.validateStrict(jt, p); err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+}
+
+func Test_validateStrict_WhenExpirationIsMissing(t *testing.T) {
+	tv := createStrictIDTokenValidator(t)
+
+	jt := createStrictToken()
+	delete(jt.Claims, "exp")
+
+	err := tv.validateStrict(jt, nil)
+	expectValidationError(t, err, ValidationErrorExpirationNotFound, http.StatusUnauthorized, nil)
+}
+
+func Test_validateStrict_WhenIssuedAtIsMissing(t *testing.T) {
+	tv := createStrictIDTokenValidator(t)
+
+	jt := createStrictToken()
+	delete(jt.Claims, "iat")
+
+	err := tv.validateStrict(jt, nil)
+	expectValidationError(t, err, ValidationErrorIssuedAtNotFound, http.StatusUnauthorized, nil)
+}
+
+func Test_validateStrict_WhenMultipleAudiencesWithoutAuthorizedParty(t *testing.T) {
+	tv := createStrictIDTokenValidator(t)
+	p := &Provider{Issuer: "https://issuer", ClientIDs: []string{"client"}}
+
+	jt := createStrictToken()
+	jt.Claims["aud"] = []interface{}{"client", "other"}
+
+	err := tv.validateStrict(jt, p)
+	expectValidationError(t, err, ValidationErrorAuthorizedPartyNotFound, http.StatusUnauthorized, nil)
+
+	jt.Claims["azp"] = "client"
+
+	if err = tv.validateStrict(jt, p); err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+}
+
+func Test_validateStrict_WhenAuthorizedPartyDoesNotMatch(t *testing.T) {
+	tv := createStrictIDTokenValidator(t)
+	p := &Provider{Issuer: "https://issuer", ClientIDs: []string{"client"}}
+
+	jt := createStrictToken()
+	jt.Claims["azp"] = "other"
+
+	err := tv.validateStrict(jt, p)
+	expectValidationError(t, err, ValidationErrorInvalidAuthorizedParty, http.StatusUnauthorized, nil)
+
+	jt.Claims["azp"] = 1
+
+	err = tv.validateStrict(jt, p)
+	expectValidationError(t, err, ValidationErrorInvalidAuthorizedParty, http.StatusUnauthorized, nil)
+}
+
+func Test_validateStrict_WhenSigningAlgorithmIsNotRS256(t *testing.T) {
+	tv := createStrictIDTokenValidator(t)
+
+	for _, alg := range []string{"none", "HS256", "RS512", ""} {
+		jt := createStrictToken()
+		jt.Header["alg"] = alg
+
+		err := tv.validateStrict(jt, &Provider{Issuer: "https://issuer", ClientIDs: []string{"client"}})
+		expectValidationError(t, err, ValidationErrorInvalidSigningAlgorithm, http.StatusUnauthorized, nil)
+	}
+}
+
+func Test_validateStrict_WhenSigningAlgorithmIsRegisteredByProvider(t *testing.T) {
+	tv := createStrictIDTokenValidator(t)
+	p := &Provider{Issuer: "https://issuer", ClientIDs: []string{"client"}, SigningAlgorithms: []string{"PS256"}}
+
+	jt := createStrictToken()
+	jt.Header["alg"] = "PS256"
+
+	if err := tv.validateStrict(jt, p); err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+
+	jt.Header["alg"] = "RS256"
+
+	err := tv.validateStrict(jt, p)
+	expectValidationError(t, err, ValidationErrorInvalidSigningAlgorithm, http.StatusUnauthorized, nil)
+}
+
+func Test_StrictValidation_EnablesStrictValidation(t *testing.T) {
+	c, _ := NewConfiguration(StrictValidation())
+
+	if !c.tokenValidator.(*idTokenValidator).strict {
+		t.Error("The strict validation should have been enabled.")
+	}
+}
+
+func createStrictIDTokenValidator(t *testing.T) *idTokenValidator {
+	_, _, _, _, tv := createIDTokenValidatorAt(t, testNow)
+	tv.strict = true
+	return tv
+}
+
+func createStrictToken() *jwtToken {
+	jt := createTokenWithClaims(jwtClaims{
+		"iss": "https://issuer",
+		"sub": "subject",
+		"aud": "client",
+		"exp": float64(testNow.Add(time.Hour).Unix()),
+		"iat": float64(testNow.Unix()),
+	})
+
+	return jt
+}
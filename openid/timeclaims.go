@@ -0,0 +1,176 @@
+package openid
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+const expirationClaimName = "exp"
+const notBeforeClaimName = "nbf"
+const issuedAtClaimName = "iat"
+
+// Clock option registers the function used as the source of the current time when validating
+// the time based claims of the tokens, i.e.: 'exp', 'nbf' and 'iat'.
+// When this option is not used then time.Now is used.
+func Clock(now func() time.Time) func(*Configuration) error {
+	return func(c *Configuration) error {
+		c.clock = now
+		return nil
+	}
+}
+
+// Leeway option registers the tolerance given to the clock skew between the service and the OPs
+// when validating the time based claims of the tokens. For instance, with a leeway of 30 seconds a
+// token is still accepted up to 30 seconds after it expires. It can be overridden per Provider.
+// When this option is not used then no leeway is given.
+func Leeway(d time.Duration) func(*Configuration) error {
+	return func(c *Configuration) error {
+		if d < 0 {
+			return &SetupError{
+				Code:    SetupErrorInvalidLeeway,
+				Message: "The leeway must not be negative.",
+			}
+		}
+
+		c.leeway = d
+		return nil
+	}
+}
+
+// validateTimeClaims validates the 'exp', 'nbf' and 'iat' claims of the token, when present,
+// using the leeway of the given provider if it has one.
+func (tv *idTokenValidator) validateTimeClaims(jt *jwtToken, p *Provider) error {
+	claims := jt.Claims
+	now := tv.now()
+	leeway := tv.leewayFor(p)
+
+	exp, ok, err := getTimeClaim(claims, expirationClaimName)
+	if err != nil {
+		return err
+	}
+
+	if ok && now.After(exp.Add(leeway)) {
+		return &ValidationError{
+			Code:       ValidationErrorJwtValidationFailure,
+			Message:    fmt.Sprintf("The token expired at %v.", exp.UTC()),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	nbf, ok, err := getTimeClaim(claims, notBeforeClaimName)
+	if err != nil {
+		return err
+	}
+
+	if ok && now.Add(leeway).Before(nbf) {
+		return &ValidationError{
+			Code:       ValidationErrorJwtValidationFailure,
+			Message:    fmt.Sprintf("The token is not valid before %v.", nbf.UTC()),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	iat, ok, err := getTimeClaim(claims, issuedAtClaimName)
+	if err != nil {
+		return err
+	}
+
+	if ok && now.Add(leeway).Before(iat) {
+		return &ValidationError{
+			Code:       ValidationErrorJwtValidationFailure,
+			Message:    fmt.Sprintf("The token was issued in the future at %v.", iat.UTC()),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	return nil
+}
+
+// getTimeClaim returns the time represented by the NumericDate claim with the given name
+// and whether the claim was found.
+func getTimeClaim(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	var secs float64
+	switch v := claims[name].(type) {
+	case nil:
+		return time.Time{}, false, nil
+	case float64:
+		secs = v
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false, invalidTimeClaimError(name, v)
+		}
+		secs = f
+	default:
+		return time.Time{}, false, invalidTimeClaimError(name, v)
+	}
+
+	t, ok := secondsToTime(secs)
+	if !ok {
+		return time.Time{}, false, &ValidationError{
+			Code:       ValidationErrorJwtValidationFailure,
+			Message:    fmt.Sprintf("The token '%v' claim is out of range.", name),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	return t, true, nil
+}
+
+// maxTimeSeconds bounds the NumericDate values, well within the range of the int64 seconds
+// time.Unix converts, so that the conversion can not overflow.
+const maxTimeSeconds = 1 << 62
+
+// secondsToTime returns the time represented by the seconds since the epoch and false when they
+// are out of range or not a number.
+func secondsToTime(secs float64) (time.Time, bool) {
+	if !(secs > -maxTimeSeconds && secs < maxTimeSeconds) {
+		return time.Time{}, false
+	}
+
+	whole := math.Floor(secs)
+	return time.Unix(int64(whole), int64((secs-whole)*float64(time.Second))), true
+}
+
+func invalidTimeClaimError(name string, v interface{}) error {
+	return &ValidationError{
+		Code:       ValidationErrorJwtValidationFailure,
+		Message:    fmt.Sprintf("The token '%v' claim has the invalid type %T.", name, v),
+		HTTPStatus: http.StatusUnauthorized,
+	}
+}
+
+// leewayFor returns the leeway of the given provider or, when it does not have one,
+// the leeway registered with the Configuration.
+func (tv *idTokenValidator) leewayFor(p *Provider) time.Duration {
+	return providerLeeway(p, tv.leeway)
+}
+
+// leewayFor returns the leeway applying to the tokens issued by the given issuer, the one of its
+// Provider or, when the provider can not be found or does not have one, the one registered with
+// the Leeway option.
+func (c *Configuration) leewayFor(iss string) time.Duration {
+	var p *Provider
+	if c.provGetter != nil {
+		if provs, err := c.provGetter(); err == nil {
+			p = providers(provs).find(iss)
+		}
+	}
+
+	return providerLeeway(p, c.leeway)
+}
+
+func providerLeeway(p *Provider, leeway time.Duration) time.Duration {
+	if p != nil && p.Leeway != nil {
+		if *p.Leeway < 0 {
+			return 0
+		}
+
+		return *p.Leeway
+	}
+
+	return leeway
+}
@@ -0,0 +1,171 @@
+package openid
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+var testNow = time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func Test_validate_WhenTokenIsExpired(t *testing.T) {
+	_, jm, _, _, tv := createIDTokenValidatorAt(t, testNow)
+
+	jt := createTokenWithClaims(jwtClaims{"exp": float64(testNow.Add(-time.Second).Unix())})
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(jt, nil)
+
+	_, err := tv.validate(nil, mock.Anything)
+
+	expectValidationError(t, err, ValidationErrorJwtValidationFailure, http.StatusUnauthorized, nil)
+	jm.AssertExpectations(t)
+}
+
+func Test_validate_WhenTokenIsExpired_WithinLeeway(t *testing.T) {
+	_, jm, _, _, tv := createIDTokenValidatorAt(t, testNow)
+	tv.leeway = 5 * time.Second
+
+	jt := createTokenWithClaims(jwtClaims{
+		"exp": float64(testNow.Add(-4 * time.Second).Unix()),
+		"nbf": float64(testNow.Add(4 * time.Second).Unix()),
+		"iat": json.Number("1577880004"),
+	})
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(jt, nil)
+
+	if _, err := tv.validate(nil, mock.Anything); err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+
+	jm.AssertExpectations(t)
+}
+
+func Test_validate_WhenTokenIsNotValidYet(t *testing.T) {
+	_, jm, _, _, tv := createIDTokenValidatorAt(t, testNow)
+
+	jt := createTokenWithClaims(jwtClaims{"nbf": float64(testNow.Add(time.Minute).Unix())})
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(jt, nil)
+
+	_, err := tv.validate(nil, mock.Anything)
+
+	expectValidationError(t, err, ValidationErrorJwtValidationFailure, http.StatusUnauthorized, nil)
+	jm.AssertExpectations(t)
+}
+
+func Test_validate_WhenTokenIsIssuedInTheFuture(t *testing.T) {
+	_, jm, _, _, tv := createIDTokenValidatorAt(t, testNow)
+
+	jt := createTokenWithClaims(jwtClaims{"iat": float64(testNow.Add(time.Minute).Unix())})
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(jt, nil)
+
+	_, err := tv.validate(nil, mock.Anything)
+
+	expectValidationError(t, err, ValidationErrorJwtValidationFailure, http.StatusUnauthorized, nil)
+	jm.AssertExpectations(t)
+}
+
+func Test_validate_WhenTimeClaimHasInvalidType(t *testing.T) {
+	_, jm, _, _, tv := createIDTokenValidatorAt(t, testNow)
+
+	jt := createTokenWithClaims(jwtClaims{"exp": "tomorrow"})
+	jm.On("parse", mock.Anything, mock.AnythingOfType("openid.jwtKeyFunc")).Return(jt, nil)
+
+	_, err := tv.validate(nil, mock.Anything)
+
+	expectValidationError(t, err, ValidationErrorJwtValidationFailure, http.StatusUnauthorized, nil)
+	jm.AssertExpectations(t)
+}
+
+func Test_validateTimeClaims_ProviderLeewayOverridesConfiguration(t *testing.T) {
+	_, _, _, _, tv := createIDTokenValidatorAt(t, testNow)
+	tv.leeway = time.Second
+
+	jt := createTokenWithClaims(jwtClaims{"exp": float64(testNow.Add(-time.Minute).Unix())})
+
+	err := tv.validateTimeClaims(jt, nil)
+	expectValidationError(t, err, ValidationErrorJwtValidationFailure, http.StatusUnauthorized, nil)
+
+	leeway := 2 * time.Minute
+	if err = tv.validateTimeClaims(jt, &Provider{Leeway: &leeway}); err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+}
+
+func Test_validateTimeClaims_ProviderLeewayCanBeZero(t *testing.T) {
+	_, _, _, _, tv := createIDTokenValidatorAt(t, testNow)
+	tv.leeway = 2 * time.Minute
+
+	jt := createTokenWithClaims(jwtClaims{"exp": float64(testNow.Add(-time.Minute).Unix())})
+
+	if err := tv.validateTimeClaims(jt, &Provider{}); err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+
+	var leeway time.Duration
+	err := tv.validateTimeClaims(jt, &Provider{Leeway: &leeway})
+	expectValidationError(t, err, ValidationErrorJwtValidationFailure, http.StatusUnauthorized, nil)
+}
+
+func Test_getTimeClaim_AfterYear2262(t *testing.T) {
+	exp := time.Date(3000, 1, 1, 0, 0, 0, 500000000, time.UTC)
+
+	rt, ok, err := getTimeClaim(jwtClaims{"exp": float64(exp.Unix()) + 0.5}, expirationClaimName)
+
+	if err != nil || !ok {
+		t.Fatal("Expected the claim to be found but got", ok, err)
+	}
+
+	if !rt.Equal(exp) {
+		t.Error("Expected the time", exp, "but got", rt)
+	}
+}
+
+func Test_getTimeClaim_WhenOutOfRange(t *testing.T) {
+	for _, v := range []interface{}{1e19, -1e19, math.Inf(1), math.NaN(), json.Number("1e300")} {
+		_, ok, err := getTimeClaim(jwtClaims{"nbf": v}, notBeforeClaimName)
+
+		if ok {
+			t.Error("The claim should not have been found for", v)
+		}
+
+		expectValidationError(t, err, ValidationErrorJwtValidationFailure, http.StatusUnauthorized, nil)
+	}
+}
+
+func Test_Leeway_WithNegativeDuration(t *testing.T) {
+	_, err := NewConfiguration(Leeway(-time.Second))
+	expectSetupError(t, err, SetupErrorInvalidLeeway)
+}
+
+func Test_Clock_IsUsedByTheValidator(t *testing.T) {
+	c, err := NewConfiguration(Clock(func() time.Time { return testNow }), Leeway(time.Minute))
+
+	if err != nil {
+		t.Fatal("An error was returned but not expected.", err)
+	}
+
+	tv := c.tokenValidator.(*idTokenValidator)
+
+	if !tv.now().Equal(testNow) {
+		t.Error("Expected the time", testNow, "but got", tv.now())
+	}
+
+	if tv.leeway != time.Minute {
+		t.Error("Expected the leeway", time.Minute, "but got", tv.leeway)
+	}
+}
+
+func createIDTokenValidatorAt(t *testing.T, now time.Time) (*mockProvidersGetter, *mockJwtParser, *mockSigningKeyGetter, *mockPemToPublicKeyParser, *idTokenValidator) {
+	pm, jm, sm, kp, tv := createIDTokenValidator(t)
+	tv.now = func() time.Time { return now }
+	return pm, jm, sm, kp, tv
+}
+
+func createTokenWithClaims(claims jwtClaims) *jwtToken {
+	return &jwtToken{
+		Header: map[string]interface{}{"typ": "JWT", "alg": "RS256"},
+		Claims: claims,
+	}
+}
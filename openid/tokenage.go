@@ -0,0 +1,140 @@
+package openid
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const authTimeClaimName = "auth_time"
+
+// TokenAgePolicy determines how old the tokens and the authentications they represent can be,
+// regardless of their expiration time.
+//
+// The MaxAge, when greater than zero, is the maximum time elapsed since the token was issued,
+// as stated by its 'iat' claim.
+//
+// The MaxLifetime, when greater than zero, is the maximum time between the token 'iat' and 'exp'
+// claims.
+//
+// The MaxAuthAge, when greater than zero, is the maximum time elapsed since the end-user
+// authenticated, as stated by the token 'auth_time' claim. This is the equivalent of the
+// OpenID Connect 'max_age' authentication request parameter.
+//
+// Tokens missing the claims required by the policy are rejected.
+type TokenAgePolicy struct {
+	MaxAge      time.Duration
+	MaxLifetime time.Duration
+	MaxAuthAge  time.Duration
+}
+
+// TokenAge option registers the policy used to limit the age of all the tokens validated with
+// the Configuration. It can be overridden per Provider. When this option is not used the age of
+// the tokens is not limited.
+func TokenAge(tp TokenAgePolicy) func(*Configuration) error {
+	return func(c *Configuration) error {
+		c.tokenAgePolicy = &tp
+		return nil
+	}
+}
+
+// RequireTokenAge returns a middleware that validates the token of the User stored in the request
+// context against the given policy before calling the next handler. It allows individual routes
+// to require more recent tokens or authentications than the ones required by the Configuration.
+// It must be stacked after Authenticate, AuthenticateUser or Middleware, the requests without a
+// User are rejected with the code ValidationErrorTokenNotFound. The leeway of the Provider that
+// issued the token applies, as it does for the TokenAge option.
+func RequireTokenAge(conf *Configuration, tp TokenAgePolicy) func(http.Handler) http.Handler {
+	return userMiddleware(conf, func(u *User, r *http.Request) error {
+		if u == nil {
+			return &ValidationError{
+				Code:       ValidationErrorTokenNotFound,
+				Message:    "The request does not carry an authenticated user.",
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+
+		return tp.validate(u.Claims, conf.clock(), conf.leewayFor(u.Issuer))
+	})
+}
+
+// validateTokenAge validates the token against the policy of the given provider or, when it
+// does not have one, against the policy registered with the Configuration.
+func (tv *idTokenValidator) validateTokenAge(jt *jwtToken, p *Provider) error {
+	tp := tv.tokenAge
+	if p != nil && p.TokenAge != nil {
+		tp = p.TokenAge
+	}
+
+	if tp == nil {
+		return nil
+	}
+
+	claims := jt.Claims
+	return tp.validate(claims, tv.now(), tv.leewayFor(p))
+}
+
+func (tp TokenAgePolicy) validate(claims map[string]interface{}, now time.Time, leeway time.Duration) error {
+	if tp.MaxAge > 0 || tp.MaxLifetime > 0 {
+		iat, ok, err := getTimeClaim(claims, issuedAtClaimName)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return &ValidationError{
+				Code:       ValidationErrorIssuedAtNotFound,
+				Message:    "The token 'iat' claim was not found.",
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+
+		if tp.MaxAge > 0 && now.Sub(iat) > tp.MaxAge+leeway {
+			return &ValidationError{
+				Code:       ValidationErrorTokenTooOld,
+				Message:    fmt.Sprintf("The token was issued at %v, more than %v ago.", iat.UTC(), tp.MaxAge),
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+
+		if tp.MaxLifetime > 0 {
+			exp, ok, err := getTimeClaim(claims, expirationClaimName)
+			if err != nil {
+				return err
+			}
+
+			if !ok || exp.Sub(iat) > tp.MaxLifetime {
+				return &ValidationError{
+					Code:       ValidationErrorTokenLifetimeTooLong,
+					Message:    fmt.Sprintf("The token lifetime exceeds %v.", tp.MaxLifetime),
+					HTTPStatus: http.StatusUnauthorized,
+				}
+			}
+		}
+	}
+
+	if tp.MaxAuthAge > 0 {
+		at, ok, err := getTimeClaim(claims, authTimeClaimName)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return &ValidationError{
+				Code:       ValidationErrorAuthTimeNotFound,
+				Message:    "The token 'auth_time' claim was not found.",
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+
+		if now.Sub(at) > tp.MaxAuthAge+leeway {
+			return &ValidationError{
+				Code:       ValidationErrorAuthenticationTooOld,
+				Message:    fmt.Sprintf("The end-user authenticated at %v, more than %v ago.", at.UTC(), tp.MaxAuthAge),
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package openid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_TokenAgePolicy_validate_MaxAge(t *testing.T) {
+	tp := TokenAgePolicy{MaxAge: time.Hour}
+
+	err := tp.validate(map[string]interface{}{}, testNow, 0)
+	expectValidationError(t, err, ValidationErrorIssuedAtNotFound, http.StatusUnauthorized, nil)
+
+	err = tp.validate(map[string]interface{}{"iat": float64(testNow.Add(-2 * time.Hour).Unix())}, testNow, 0)
+	expectValidationError(t, err, ValidationErrorTokenTooOld, http.StatusUnauthorized, nil)
+
+	if err = tp.validate(map[string]interface{}{"iat": float64(testNow.Add(-time.Hour - time.Second).Unix())}, testNow, time.Minute); err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+}
+
+func Test_TokenAgePolicy_validate_MaxLifetime(t *testing.T) {
+	tp := TokenAgePolicy{MaxLifetime: time.Hour}
+	iat := float64(testNow.Unix())
+
+	err := tp.validate(map[string]interface{}{"iat": iat}, testNow, 0)
+	expectValidationError(t, err, ValidationErrorTokenLifetimeTooLong, http.StatusUnauthorized, nil)
+
+	err = tp.validate(map[string]interface{}{"iat": iat, "exp": iat + float64(365*24*3600)}, testNow, 0)
+	expectValidationError(t, err, ValidationErrorTokenLifetimeTooLong, http.StatusUnauthorized, nil)
+
+	if err = tp.validate(map[string]interface{}{"iat": iat, "exp": iat + 3600}, testNow, 0); err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+}
+
+func Test_TokenAgePolicy_validate_MaxAuthAge(t *testing.T) {
+	tp := TokenAgePolicy{MaxAuthAge: 5 * time.Minute}
+
+	err := tp.validate(map[string]interface{}{}, testNow, 0)
+	expectValidationError(t, err, ValidationErrorAuthTimeNotFound, http.StatusUnauthorized, nil)
+
+	err = tp.validate(map[string]interface{}{"auth_time": float64(testNow.Add(-time.Hour).Unix())}, testNow, 0)
+	expectValidationError(t, err, ValidationErrorAuthenticationTooOld, http.StatusUnauthorized, nil)
+
+	if err = tp.validate(map[string]interface{}{"auth_time": float64(testNow.Add(-time.Minute).Unix())}, testNow, 0); err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+}
+
+func Test_validateTokenAge_ProviderPolicyOverridesConfiguration(t *testing.T) {
+	_, _, _, _, tv := createIDTokenValidatorAt(t, testNow)
+	tv.tokenAge = &TokenAgePolicy{MaxAge: time.Minute}
+
+	jt := createTokenWithClaims(jwtClaims{"iat": float64(testNow.Add(-time.Hour).Unix())})
+
+	err := tv.validateTokenAge(jt, nil)
+	expectValidationError(t, err, ValidationErrorTokenTooOld, http.StatusUnauthorized, nil)
+
+	if err = tv.validateTokenAge(jt, &Provider{TokenAge: &TokenAgePolicy{MaxAge: 2 * time.Hour}}); err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+}
+
+func Test_RequireTokenAge_WhenAuthenticationIsTooOld(t *testing.T) {
+	_, c := createConfiguration(t, nil, nil)
+	c.clock = func() time.Time { return testNow }
+
+	u := &User{Issuer: "https://issuer", ID: "SUB1", Claims: jwtClaims{"auth_time": float64(testNow.Add(-time.Hour).Unix())}}
+
+	called := false
+	h := RequireTokenAge(c, TokenAgePolicy{MaxAuthAge: time.Minute})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, requestWithUser(httptest.NewRequest(http.MethodGet, "/", nil), u))
+
+	if called {
+		t.Error("The next handler should not have been called.")
+	}
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Error("Expected status", http.StatusUnauthorized, "but got", rr.Code)
+	}
+}
+
+func Test_RequireTokenAge_WhenAuthenticationIsRecent(t *testing.T) {
+	vm, c := createConfiguration(t, nil, getIDTokenReturnsSuccess)
+	c.clock = func() time.Time { return testNow }
+
+	jt := createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "SUB1", "auth_time": float64(testNow.Add(-time.Second).Unix())})
+	vm.On("validate", mock.Anything, idToken).Return(jt, nil)
+
+	var ru *User
+	h := Middleware(c)(RequireTokenAge(c, TokenAgePolicy{MaxAuthAge: time.Minute})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ru, _ = UserFromContext(r.Context())
+	})))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if ru == nil || ru.ID != "SUB1" {
+		t.Errorf("Expected the next handler to be called with the user, but got %+v.", ru)
+	}
+
+	vm.AssertExpectations(t)
+}
+
+func Test_RequireTokenAge_WhenUserIsNotInContext(t *testing.T) {
+	var herr error
+	_, c := createConfiguration(t, func(e error, w http.ResponseWriter, r *http.Request) bool {
+		herr = e
+		return true
+	}, nil)
+	c.clock = func() time.Time { return testNow }
+
+	for _, tp := range []TokenAgePolicy{{MaxAuthAge: time.Minute}, {}} {
+		herr = nil
+		h := RequireTokenAge(c, tp)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("The next handler should not have been called.")
+		}))
+
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		expectValidationError(t, herr, ValidationErrorTokenNotFound, http.StatusUnauthorized, nil)
+	}
+}
+
+func Test_RequireTokenAge_UsesProviderLeeway(t *testing.T) {
+	leeway := 2 * time.Minute
+	_, c := createConfiguration(t, nil, nil)
+	c.clock = func() time.Time { return testNow }
+	c.provGetter = func() ([]Provider, error) {
+		return []Provider{{Issuer: "https://issuer", ClientIDs: []string{"client"}, Leeway: &leeway}}, nil
+	}
+
+	u := &User{Issuer: "https://issuer", ID: "SUB1", Claims: jwtClaims{"auth_time": float64(testNow.Add(-2 * time.Minute).Unix())}}
+
+	called := false
+	h := RequireTokenAge(c, TokenAgePolicy{MaxAuthAge: time.Minute})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), requestWithUser(httptest.NewRequest(http.MethodGet, "/", nil), u))
+
+	if !called {
+		t.Error("The next handler should have been called within the provider leeway.")
+	}
+}
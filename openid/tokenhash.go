@@ -0,0 +1,87 @@
+package openid
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	// Registers the hash functions used by the supported signing algorithms.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+const accessTokenHashClaimName = "at_hash"
+const codeHashClaimName = "c_hash"
+
+// VerifyAccessToken verifies that the given access token was issued along with the user's
+// ID Token, as described in the section 3.2.2.9 of the OpenID Connect Core specification.
+// The 'at_hash' claim of the ID Token must match the left-most half of the hash of the access
+// token, computed with the hash function implied by the ID Token 'alg' header.
+// It returns an error of the type *ValidationError if the verification fails.
+func (u *User) VerifyAccessToken(accessToken string) error {
+	return u.verifyTokenHash(accessTokenHashClaimName, accessToken, ValidationErrorAccessTokenHashNotFound, ValidationErrorInvalidAccessTokenHash)
+}
+
+// VerifyCode verifies that the given authorization code was issued along with the user's
+// ID Token, as described in the section 3.3.2.11 of the OpenID Connect Core specification.
+// The 'c_hash' claim of the ID Token must match the left-most half of the hash of the code,
+// computed with the hash function implied by the ID Token 'alg' header.
+// It returns an error of the type *ValidationError if the verification fails.
+func (u *User) VerifyCode(code string) error {
+	return u.verifyTokenHash(codeHashClaimName, code, ValidationErrorCodeHashNotFound, ValidationErrorInvalidCodeHash)
+}
+
+func (u *User) verifyTokenHash(claimName string, value string, notFound ValidationErrorCode, invalid ValidationErrorCode) error {
+	claim, _ := u.Claims[claimName].(string)
+	if claim == "" {
+		return &ValidationError{
+			Code:       notFound,
+			Message:    fmt.Sprintf("The token '%v' claim was not found or was empty.", claimName),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	h, err := tokenHash(u.algorithm, value)
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(h), []byte(claim)) != 1 {
+		return &ValidationError{
+			Code:       invalid,
+			Message:    fmt.Sprintf("The token '%v' claim does not match the expected value.", claimName),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	return nil
+}
+
+// tokenHash returns the base64url encoding of the left-most half of the hash of the value,
+// computed with the hash function used by the given signing algorithm.
+func tokenHash(alg string, value string) (string, error) {
+	var hf crypto.Hash
+	switch alg {
+	case "HS256", "RS256", "ES256", "PS256":
+		hf = crypto.SHA256
+	case "HS384", "RS384", "ES384", "PS384":
+		hf = crypto.SHA384
+	case "HS512", "RS512", "ES512", "PS512", "EdDSA":
+		// EdDSA tokens are signed with Ed25519 in practice, which uses SHA-512.
+		hf = crypto.SHA512
+	default:
+		return "", &ValidationError{
+			Code:       ValidationErrorInvalidSigningAlgorithm,
+			Message:    fmt.Sprintf("The hash function of the signing algorithm %q is not known.", alg),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	h := hf.New()
+	h.Write([]byte(value))
+	sum := h.Sum(nil)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
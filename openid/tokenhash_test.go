@@ -0,0 +1,92 @@
+package openid
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http"
+	"testing"
+)
+
+func Test_tokenHash_UsesTheHashOfTheAlgorithm(t *testing.T) {
+	at := "jHkWEdUXMU1BwAsC4vtUsZwnNNW9cv-lzjm_ewmd3LbM"
+	s256 := sha256.Sum256([]byte(at))
+	s384 := sha512.Sum384([]byte(at))
+	s512 := sha512.Sum512([]byte(at))
+
+	for alg, sum := range map[string][]byte{
+		"RS256": s256[:16],
+		"ES256": s256[:16],
+		"PS256": s256[:16],
+		"ES384": s384[:24],
+		"RS384": s384[:24],
+		"PS512": s512[:32],
+		"RS512": s512[:32],
+		"EdDSA": s512[:32],
+	} {
+		h, err := tokenHash(alg, at)
+
+		if err != nil {
+			t.Error("An error was returned but not expected for", alg, err)
+		}
+
+		if e := base64.RawURLEncoding.EncodeToString(sum); h != e {
+			t.Errorf("Expected hash %v for %v, but got %v.", e, alg, h)
+		}
+	}
+}
+
+func Test_tokenHash_WhenAlgorithmIsUnknown(t *testing.T) {
+	_, err := tokenHash("none", "token")
+
+	expectValidationError(t, err, ValidationErrorInvalidSigningAlgorithm, http.StatusUnauthorized, nil)
+}
+
+func Test_User_VerifyAccessToken_WhenHashMatches(t *testing.T) {
+	u := &User{Claims: map[string]interface{}{"at_hash": "A0EkFn5SfxeHiwuW3MK3xA"}, algorithm: "RS256"}
+
+	if err := u.VerifyAccessToken("jHkWEdUXMU1BwAsC4vtUsZwnNNW9cv-lzjm_ewmd3LbM"); err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+}
+
+func Test_User_VerifyAccessToken_WhenHashDoesNotMatch(t *testing.T) {
+	u := &User{Claims: map[string]interface{}{"at_hash": "A0EkFn5SfxeHiwuW3MK3xA"}, algorithm: "ES384"}
+
+	err := u.VerifyAccessToken("jHkWEdUXMU1BwAsC4vtUsZwnNNW9cv-lzjm_ewmd3LbM")
+
+	expectValidationError(t, err, ValidationErrorInvalidAccessTokenHash, http.StatusUnauthorized, nil)
+}
+
+func Test_User_VerifyAccessToken_WhenClaimIsMissing(t *testing.T) {
+	u := &User{Claims: map[string]interface{}{}, algorithm: "RS256"}
+
+	err := u.VerifyAccessToken("token")
+
+	expectValidationError(t, err, ValidationErrorAccessTokenHashNotFound, http.StatusUnauthorized, nil)
+}
+
+func Test_User_VerifyCode_WhenHashMatches(t *testing.T) {
+	// Example from the OpenID Connect Core specification, appendix A.4.
+	u := &User{Claims: map[string]interface{}{"c_hash": "LDktKdoQak3Pk0cnXxCltA"}, algorithm: "RS256"}
+
+	if err := u.VerifyCode("Qcb0Orv1zh30vL1MPRsbm-diHiMwcLyZvn1arpZv-Jxf_11jnpEX3Tgfvk"); err != nil {
+		t.Error("An error was returned but not expected.", err)
+	}
+}
+
+func Test_User_VerifyCode_WhenHashDoesNotMatch(t *testing.T) {
+	u := &User{Claims: map[string]interface{}{"c_hash": "LDktKdoQak3Pk0cnXxCltA"}, algorithm: "RS256"}
+
+	err := u.VerifyCode("another code")
+
+	expectValidationError(t, err, ValidationErrorInvalidCodeHash, http.StatusUnauthorized, nil)
+}
+
+func Test_User_VerifyCode_WhenClaimIsMissing(t *testing.T) {
+	u := &User{Claims: map[string]interface{}{}, algorithm: "RS256"}
+
+	err := u.VerifyCode("code")
+
+	expectValidationError(t, err, ValidationErrorCodeHashNotFound, http.StatusUnauthorized, nil)
+}
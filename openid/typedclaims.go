@@ -0,0 +1,72 @@
+//go:build go1.18
+// +build go1.18
+
+package openid
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// The ClaimsHandler represents a handler to be registered by the middleware AuthenticateWithClaims.
+//
+// ServeHTTPWithClaims is similar to ServeHTTPWithUser. It contains an additional parameter of
+// the type T, which contains the claims of the token decoded into the application's own type.
+type ClaimsHandler[T any] interface {
+	ServeHTTPWithClaims(*User, T, http.ResponseWriter, *http.Request)
+}
+
+// The ClaimsHandlerFunc is an adapter to allow the use of functions as ClaimsHandler.
+type ClaimsHandlerFunc[T any] func(*User, T, http.ResponseWriter, *http.Request)
+
+// ServeHTTPWithClaims calls f(u, claims, w, r)
+func (f ClaimsHandlerFunc[T]) ServeHTTPWithClaims(u *User, claims T, w http.ResponseWriter, r *http.Request) {
+	f(u, claims, w, r)
+}
+
+// AuthenticateWithClaims middleware performs the same validation as AuthenticateUser and in
+// addition decodes the token claims into a value of the type T, using its JSON tags, before
+// forwarding it along with the authenticated user's information to the next handler.
+// If the claims can not be decoded the error is handled by the ErrorHandlerFunc with the code
+// ValidationErrorClaimsDecodeFailure. If the ErrorHandlerFunc does not stop the execution the
+// next handler receives the zero value of T.
+func AuthenticateWithClaims[T any](conf *Configuration, h ClaimsHandler[T]) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, halt := authenticateUser(conf, w, r)
+		if halt {
+			return
+		}
+
+		var claims T
+		if u != nil {
+			var err error
+			if claims, err = decodeClaims[T](u.Claims); err != nil {
+				if conf.getErrorHandler()(err, w, r) {
+					return
+				}
+			}
+		}
+
+		h.ServeHTTPWithClaims(u, claims, w, requestWithUser(r, u))
+	})
+}
+
+func decodeClaims[T any](claims map[string]interface{}) (T, error) {
+	var t T
+	b, err := json.Marshal(claims)
+	if err == nil {
+		err = json.Unmarshal(b, &t)
+	}
+
+	if err != nil {
+		var zero T
+		return zero, &ValidationError{
+			Code:       ValidationErrorClaimsDecodeFailure,
+			Message:    "The token claims could not be decoded.",
+			Err:        err,
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,93 @@
+//go:build go1.18
+// +build go1.18
+
+package openid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type testClaims struct {
+	Email  string   `json:"email"`
+	Groups []string `json:"groups"`
+	Tenant string   `json:"tid"`
+}
+
+func Test_AuthenticateWithClaims_WhenClaimsAreDecoded(t *testing.T) {
+	vm, c := createConfiguration(t, errorHandlerHalt, getIDTokenReturnsSuccess)
+
+	jt := createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "SUB1", "email": "user@issuer", "groups": []interface{}{"admins", "users"}, "tid": "tenant"})
+
+	vm.On("validate", mock.Anything, idToken).Return(jt, nil)
+
+	called := false
+	h := AuthenticateWithClaims[testClaims](c, ClaimsHandlerFunc[testClaims](func(u *User, claims testClaims, w http.ResponseWriter, r *http.Request) {
+		called = true
+
+		if u == nil || u.ID != "SUB1" {
+			t.Errorf("Expected the user SUB1, but got %+v.", u)
+		}
+
+		if claims.Email != "user@issuer" || claims.Tenant != "tenant" || len(claims.Groups) != 2 || claims.Groups[1] != "users" {
+			t.Errorf("Unexpected decoded claims %+v.", claims)
+		}
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !called {
+		t.Error("The handler should have been called.")
+	}
+
+	vm.AssertExpectations(t)
+}
+
+func Test_AuthenticateWithClaims_WhenClaimsCanNotBeDecoded(t *testing.T) {
+	var herr error
+	vm, c := createConfiguration(t, func(e error, w http.ResponseWriter, r *http.Request) bool {
+		herr = e
+		return true
+	}, getIDTokenReturnsSuccess)
+
+	jt := createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "SUB1", "groups": "admins"})
+
+	vm.On("validate", mock.Anything, idToken).Return(jt, nil)
+
+	h := AuthenticateWithClaims[testClaims](c, ClaimsHandlerFunc[testClaims](func(u *User, claims testClaims, w http.ResponseWriter, r *http.Request) {
+		t.Error("The handler should not have been called.")
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	expectValidationError(t, herr, ValidationErrorClaimsDecodeFailure, http.StatusUnauthorized, nil)
+	vm.AssertExpectations(t)
+}
+
+func Test_AuthenticateWithClaims_WhenDecodeErrorDoesNotHalt(t *testing.T) {
+	vm, c := createConfiguration(t, errorHandlerContinue, getIDTokenReturnsSuccess)
+
+	jt := createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "SUB1", "email": 42})
+
+	vm.On("validate", mock.Anything, idToken).Return(jt, nil)
+
+	called := false
+	h := AuthenticateWithClaims[*testClaims](c, ClaimsHandlerFunc[*testClaims](func(u *User, claims *testClaims, w http.ResponseWriter, r *http.Request) {
+		called = true
+
+		if claims != nil {
+			t.Errorf("Expected nil claims, but got %+v.", claims)
+		}
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !called {
+		t.Error("The handler should have been called.")
+	}
+
+	vm.AssertExpectations(t)
+}
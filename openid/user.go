@@ -2,8 +2,6 @@ package openid
 
 import (
 	"net/http"
-
-	"github.com/dgrijalva/jwt-go"
 )
 
 // User represents the authenticated user encapsulating information obtained from the validated ID token.
@@ -12,14 +10,23 @@ import (
 //
 // The ID contains the value of the 'sub' claim found in the ID Token.
 //
-// The Claims contains all the claims present found in the ID Token
+// The Claims contains all the claims present found in the ID Token.
+//
+// The StandardClaims contains the standard claims about the end-user found in the ID Token, decoded
+// from the Claims.
 type User struct {
-	Issuer string
-	ID     string
-	Claims map[string]interface{}
+	Issuer         string
+	ID             string
+	Claims         map[string]interface{}
+	StandardClaims StandardClaims
+
+	// algorithm is the 'alg' header of the ID Token, used to verify the 'at_hash' and 'c_hash' claims.
+	algorithm string
+	// rawToken is the token the user was authenticated with, stored in the request context.
+	rawToken string
 }
 
-func newUser(t *jwt.Token) (*User, error) {
+func newUser(t *jwtToken) (*User, error) {
 	if t == nil {
 		return nil, &ValidationError{
 			Code:       ValidationErrorIdTokenEmpty,
@@ -52,6 +59,9 @@ func newUser(t *jwt.Token) (*User, error) {
 	u := new(User)
 	u.Issuer = iss
 	u.ID = sub
-	u.Claims = t.Claims.(jwt.MapClaims)
+	u.Claims = t.Claims
+	u.StandardClaims = newStandardClaims(u.Claims)
+	u.algorithm, _ = t.Header[algorithmJwtHeaderName].(string)
+	u.rawToken = t.Raw
 	return u, nil
 }
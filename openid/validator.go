@@ -0,0 +1,70 @@
+package openid
+
+import (
+	"context"
+	"net/http"
+)
+
+// Validator validates tokens independently of the HTTP middlewares, for instance tokens received
+// through message queues, gRPC metadata or command line arguments.
+// It is created from a Configuration with NewValidator and shares with it the providers, the
+// cached OP configurations and signing keys and all the validation options registered, including
+// the policies registered with the AuthorizationPolicy option. The Authenticate and
+// AuthenticateUser middlewares are built on top of it.
+type Validator struct {
+	conf *Configuration
+}
+
+// NewValidator returns the Validator validating tokens with the given Configuration.
+func NewValidator(conf *Configuration) *Validator {
+	return &Validator{conf: conf}
+}
+
+// Validate validates the raw token and returns the user it identifies. The context is used for the
+// requests to the OPs, the introspection endpoints and the RevocationStore.
+// The extension points registered with the Configuration that receive an *http.Request, such as
+// the HTTPGetFunc, the NonceVerifier and the ClaimsValidators, receive a request without URL nor
+// headers carrying the context.
+// The errors returned are of the same types as the ones given to the ErrorHandlerFunc by the
+// middlewares, i.e.: *ValidationError or *AuthorizationError. The errors returned by the
+// GetProvidersFunc are wrapped in a *ValidationError with the code
+// ValidationErrorJwtValidationFailure.
+func (v *Validator) Validate(ctx context.Context, rawToken string) (*User, error) {
+	r, err := http.NewRequest(http.MethodGet, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r = r.WithContext(ctx)
+
+	jt, err := v.validate(r, rawToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return newUser(jt)
+}
+
+// validate validates the token received with the contextual request and enforces the policies
+// registered with the AuthorizationPolicy option. When the token is valid but not authorized by
+// the policies it is returned along with the error, the middlewares forward it to the next handler
+// when the ErrorHandlerFunc does not halt the execution.
+func (v *Validator) validate(r *http.Request, t string) (*jwtToken, error) {
+	jt, err := v.conf.tokenValidator.validate(r, t)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(v.conf.policies) > 0 {
+		u, err := newUser(jt)
+		if err == nil {
+			err = authorizePolicies(u, v.conf.policies...)
+		}
+
+		if err != nil {
+			return jt, err
+		}
+	}
+
+	return jt, nil
+}
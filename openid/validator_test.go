@@ -0,0 +1,70 @@
+package openid
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type validatorTestKey struct{}
+
+func Test_Validator_Validate(t *testing.T) {
+	vm, c := createConfiguration(t, nil, nil)
+	jt := createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "SUB1", "email": "user@issuer"})
+
+	ctx := context.WithValue(context.Background(), validatorTestKey{}, "value")
+	vm.On("validate", mock.MatchedBy(func(r *http.Request) bool {
+		return r != nil && r.Context().Value(validatorTestKey{}) == "value"
+	}), idToken).Return(jt, nil)
+
+	u, err := NewValidator(c).Validate(ctx, idToken)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "https://issuer", u.Issuer)
+	assert.Equal(t, "SUB1", u.ID)
+	assert.Equal(t, "user@issuer", u.Claims["email"])
+	vm.AssertExpectations(t)
+}
+
+func Test_Validator_Validate_WhenTokenIsInvalid(t *testing.T) {
+	vm, c := createConfiguration(t, nil, nil)
+	ve := &ValidationError{Code: ValidationErrorJwtValidationFailure, HTTPStatus: http.StatusUnauthorized}
+
+	vm.On("validate", mock.Anything, idToken).Return(nil, ve)
+
+	u, err := NewValidator(c).Validate(context.Background(), idToken)
+
+	assert.Nil(t, u)
+	assert.Equal(t, ve, err)
+}
+
+func Test_Validator_Validate_WhenPolicyDenies(t *testing.T) {
+	vm, c := createConfiguration(t, nil, nil)
+	c.policies = []*Policy{MustCompilePolicy(`claims.email_verified == true`)}
+	jt := createTokenWithClaims(jwtClaims{"iss": "https://issuer", "sub": "SUB1", "email_verified": false})
+
+	vm.On("validate", mock.Anything, idToken).Return(jt, nil)
+
+	u, err := NewValidator(c).Validate(context.Background(), idToken)
+
+	assert.Nil(t, u)
+	expectAuthorizationError(t, err, AuthorizationErrorPolicyDenied)
+}
+
+func Test_Validator_Validate_WhenProvidersGetterFails(t *testing.T) {
+	ge := errors.New("providers not available")
+	c, err := NewConfiguration(ProvidersGetter(func() ([]Provider, error) { return nil, ge }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := signToken(t, "RS256", generateRSAKey(t), `{"iss":"https://issuer","sub":"SUB1","aud":"client"}`)
+
+	_, err = NewValidator(c).Validate(context.Background(), raw)
+
+	expectValidationError(t, err, ValidationErrorJwtValidationFailure, http.StatusUnauthorized, ge)
+}